@@ -0,0 +1,42 @@
+package audit
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"w00k/go/rest-ws/metrics"
+	"w00k/go/rest-ws/requestid"
+)
+
+const (
+	// LOGIN_LOCKOUT: se bloquearon temporalmente los logins de una cuenta o de una ip
+	LOGIN_LOCKOUT = "login.lockout"
+)
+
+// events: cantidad de eventos de cada tipo, se publica en /debug/vars como "audit"
+var events = new(expvar.Map)
+
+func init() {
+	metrics.Publish("audit", events)
+}
+
+// Record: registra el evento en el log con el id del request, los valores van entre comillas
+// porque pueden venir del cliente (por ejemplo el correo de un login)
+func Record(ctx context.Context, event string, fields map[string]string) {
+	events.Add(event, 1)
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var line strings.Builder
+	line.WriteString("audit: event=" + event)
+	for _, key := range keys {
+		line.WriteString(" " + key + "=" + strconv.Quote(fields[key]))
+	}
+	line.WriteString(" request_id=" + requestid.From(ctx))
+	log.Println(line.String())
+}
@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"w00k/go/rest-ws/models"
+)
+
+const BEARER_PREFIX = "Bearer "
+
+type claimsKey struct{}
+
+// WithClaims: guarda en el contexto los claims del token ya validado
+func WithClaims(ctx context.Context, claims *models.AppClaims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFrom: obtiene los claims que guardó el middleware de autenticación,
+// retorna false si el request no pasó por la autenticación
+func ClaimsFrom(ctx context.Context) (*models.AppClaims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*models.AppClaims)
+	return claims, ok && claims != nil
+}
+
+// UserIdFrom: id del usuario autenticado, si no hay retorna vacío
+func UserIdFrom(ctx context.Context) string {
+	if claims, ok := ClaimsFrom(ctx); ok {
+		return claims.UserId
+	}
+	return ""
+}
+
+// TokenFromHeader: obtiene el token del header Authorization, acepta "Bearer <token>"
+// y, por compatibilidad con los clientes existentes, el token sin prefijo
+func TokenFromHeader(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) >= len(BEARER_PREFIX) && strings.EqualFold(value[:len(BEARER_PREFIX)], BEARER_PREFIX) {
+		return strings.TrimSpace(value[len(BEARER_PREFIX):])
+	}
+	return value
+}
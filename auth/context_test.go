@@ -0,0 +1,27 @@
+package auth
+
+import "testing"
+
+func TestTokenFromHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{"bearer", "Bearer abc.def.ghi", "abc.def.ghi"},
+		{"lowercase bearer", "bearer abc.def.ghi", "abc.def.ghi"},
+		{"uppercase bearer", "BEARER abc.def.ghi", "abc.def.ghi"},
+		{"extra spaces", "  Bearer    abc.def.ghi  ", "abc.def.ghi"},
+		{"lowercase with extra spaces", "bearer   abc.def.ghi", "abc.def.ghi"},
+		{"bare token", "abc.def.ghi", "abc.def.ghi"},
+		{"bare token with spaces", " abc.def.ghi ", "abc.def.ghi"},
+		{"empty", "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := TokenFromHeader(test.header); got != test.want {
+				t.Errorf("TokenFromHeader(%q) = %q, want %q", test.header, got, test.want)
+			}
+		})
+	}
+}
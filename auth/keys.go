@@ -0,0 +1,362 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	HS256        = "HS256"
+	RS256        = "RS256"
+	ES256        = "ES256"
+	RSA_KEY_BITS = 2048
+)
+
+var (
+	// ErrUnexpectedAlgorithm: el token está firmado con un algoritmo distinto al configurado
+	ErrUnexpectedAlgorithm = errors.New("unexpected signing algorithm")
+	// ErrUnknownKey: el token está firmado con una llave que no existe o que ya se retiró
+	ErrUnknownKey = errors.New("unknown signing key")
+)
+
+type KeyConfig struct {
+	Algorithm string // HS256, RS256 o ES256
+	// Secret: secreto compartido para HS256
+	Secret string
+	// PrivateKeyFiles: llaves privadas en PEM para RS256/ES256, la primera firma y el resto solo
+	// se usan para validar (rotación manual), si no hay archivos se genera una llave al iniciar
+	PrivateKeyFiles []string
+	// RotationInterval: con llaves generadas, cada cuánto se genera una nueva llave; con
+	// PrivateKeyFiles, cada cuánto se vuelven a leer los archivos para tomar las llaves nuevas
+	RotationInterval time.Duration
+	// Overlap: tiempo que una llave reemplazada sigue validando tokens, debe ser al menos
+	// la duración de los access tokens para no invalidar los que ya se emitieron
+	Overlap time.Duration
+}
+
+// signingKey: llave identificada por kid, retiredAt es cuándo dejó de firmar
+type signingKey struct {
+	kid       string
+	private   interface{}
+	public    interface{}
+	retiredAt *time.Time
+}
+
+// KeyManager: firma y valida los tokens, con RS256/ES256 publica las llaves públicas
+// vigentes en formato JWKS para que otros servicios validen los tokens sin el secreto
+type KeyManager struct {
+	config KeyConfig
+	method jwt.SigningMethod
+	mutex  sync.RWMutex
+	keys   []*signingKey // la primera es la que firma
+}
+
+func NewKeyManager(config KeyConfig) (*KeyManager, error) {
+	manager := &KeyManager{config: config}
+	switch config.Algorithm {
+	case HS256, "":
+		if config.Secret == "" {
+			return nil, errors.New("secret is required for " + HS256)
+		}
+		manager.method = jwt.SigningMethodHS256
+		manager.keys = []*signingKey{{private: []byte(config.Secret), public: []byte(config.Secret)}}
+		return manager, nil
+	case RS256:
+		manager.method = jwt.SigningMethodRS256
+	case ES256:
+		manager.method = jwt.SigningMethodES256
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", config.Algorithm)
+	}
+	if len(config.PrivateKeyFiles) > 0 {
+		keys, err := manager.loadKeys()
+		if err != nil {
+			return nil, err
+		}
+		manager.keys = keys
+		return manager, nil
+	}
+	if err := manager.Rotate(); err != nil {
+		return nil, err
+	}
+	return manager, nil
+}
+
+// Ephemeral: las llaves se generan en memoria, los tokens dejan de ser válidos al reiniciar
+// y no son válidos en otras instancias, que publican un JWKS distinto
+func (manager *KeyManager) Ephemeral() bool {
+	return manager.method != jwt.SigningMethodHS256 && len(manager.config.PrivateKeyFiles) == 0
+}
+
+// loadKeys: lee las llaves de PrivateKeyFiles en orden, la primera es la que firma
+func (manager *KeyManager) loadKeys() ([]*signingKey, error) {
+	var keys []*signingKey
+	for _, file := range manager.config.PrivateKeyFiles {
+		key, err := loadKey(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if err := manager.checkKey(key); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// Reload: vuelve a leer PrivateKeyFiles, la primera llave pasa a firmar y las llaves que ya no
+// están en los archivos siguen validando durante Overlap, así para rotar basta con agregar la
+// nueva llave al inicio del primer archivo de la lista sin reiniciar las instancias
+func (manager *KeyManager) Reload() error {
+	keys, err := manager.loadKeys()
+	if err != nil {
+		return err
+	}
+
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	now := time.Now()
+	loaded := map[string]bool{}
+	for _, key := range keys {
+		loaded[key.kid] = true
+	}
+	for _, previous := range manager.keys {
+		if loaded[previous.kid] {
+			continue
+		}
+		if previous.retiredAt == nil {
+			previous.retiredAt = &now
+		}
+		if !manager.expired(previous, now) {
+			keys = append(keys, previous)
+		}
+	}
+	manager.keys = keys
+	return nil
+}
+
+// Algorithm: algoritmo con el que se firman y validan los tokens
+func (manager *KeyManager) Algorithm() string {
+	return manager.method.Alg()
+}
+
+// Sign: firma los claims con la llave activa e incluye su kid en el header
+func (manager *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	manager.mutex.RLock()
+	key := manager.keys[0]
+	manager.mutex.RUnlock()
+
+	token := jwt.NewWithClaims(manager.method, claims)
+	if key.kid != "" {
+		token.Header["kid"] = key.kid
+	}
+	return token.SignedString(key.private)
+}
+
+// Keyfunc: para jwt.Parse, rechaza los tokens firmados con otro algoritmo (por ejemplo "none"
+// o HS256 usando la llave pública como secreto) y busca la llave por kid
+func (manager *KeyManager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if token.Method == nil || token.Method.Alg() != manager.method.Alg() {
+		return nil, ErrUnexpectedAlgorithm
+	}
+	kid, _ := token.Header["kid"].(string)
+
+	manager.mutex.RLock()
+	defer manager.mutex.RUnlock()
+	for _, key := range manager.keys {
+		if key.kid == kid && !manager.expired(key, time.Now()) {
+			return key.public, nil
+		}
+	}
+	return nil, ErrUnknownKey
+}
+
+// Rotate: genera una nueva llave para firmar, la anterior sigue validando durante Overlap
+func (manager *KeyManager) Rotate() error {
+	var private crypto.Signer
+	var err error
+	switch manager.method {
+	case jwt.SigningMethodRS256:
+		private, err = rsa.GenerateKey(rand.Reader, RSA_KEY_BITS)
+	case jwt.SigningMethodES256:
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		return fmt.Errorf("cannot rotate %s keys", manager.method.Alg())
+	}
+	if err != nil {
+		return err
+	}
+	key, err := newSigningKey(private)
+	if err != nil {
+		return err
+	}
+
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	now := time.Now()
+	keys := []*signingKey{key}
+	for _, previous := range manager.keys {
+		if previous.retiredAt == nil {
+			previous.retiredAt = &now
+		}
+		if !manager.expired(previous, now) {
+			keys = append(keys, previous)
+		}
+	}
+	manager.keys = keys
+	return nil
+}
+
+// Run: cada RotationInterval genera una nueva llave o, con PrivateKeyFiles, vuelve a leer los
+// archivos (Reload), hasta que se cancele el contexto; no hace nada con HS256 o si RotationInterval es 0
+func (manager *KeyManager) Run(ctx context.Context) {
+	if manager.method == jwt.SigningMethodHS256 || manager.config.RotationInterval <= 0 {
+		return
+	}
+	rotate := manager.Rotate
+	if len(manager.config.PrivateKeyFiles) > 0 {
+		rotate = manager.Reload
+	}
+	ticker := time.NewTicker(manager.config.RotationInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := rotate(); err != nil {
+				log.Println("key rotation: ", err)
+			}
+		}
+	}
+}
+
+// expired: la llave se retiró hace más de Overlap y ya no valida tokens
+func (manager *KeyManager) expired(key *signingKey, now time.Time) bool {
+	return key.retiredAt != nil && now.Sub(*key.retiredAt) > manager.config.Overlap
+}
+
+// checkKey: la llave cargada debe corresponder al algoritmo configurado
+func (manager *KeyManager) checkKey(key *signingKey) error {
+	switch key.private.(type) {
+	case *rsa.PrivateKey:
+		if manager.method == jwt.SigningMethodRS256 {
+			return nil
+		}
+	case *ecdsa.PrivateKey:
+		if manager.method == jwt.SigningMethodES256 && key.private.(*ecdsa.PrivateKey).Curve == elliptic.P256() {
+			return nil
+		}
+	}
+	return fmt.Errorf("key does not match %s", manager.method.Alg())
+}
+
+// loadKey: lee una llave privada RSA o EC en PEM (PKCS#8, PKCS#1 o SEC 1)
+func loadKey(file string) (*signingKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid PEM")
+	}
+	var private interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		private, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported private key")
+	}
+	return newSigningKey(signer)
+}
+
+// newSigningKey: el kid se deriva de la llave pública, así todas las instancias
+// que cargan el mismo archivo usan el mismo kid
+func newSigningKey(private crypto.Signer) (*signingKey, error) {
+	der, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(der)
+	return &signingKey{
+		kid:     base64.RawURLEncoding.EncodeToString(sum[:16]),
+		private: private,
+		public:  private.Public(),
+	}, nil
+}
+
+// JSONWebKey: llave pública en formato JWK (RFC 7517)
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JWKS: llaves públicas que validan tokens en este momento, vacío con HS256
+// porque el secreto compartido no se puede publicar
+func (manager *KeyManager) JWKS() JSONWebKeySet {
+	manager.mutex.RLock()
+	defer manager.mutex.RUnlock()
+
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	now := time.Now()
+	for _, key := range manager.keys {
+		if manager.expired(key, now) {
+			continue
+		}
+		jwk := JSONWebKey{Kid: key.kid, Use: "sig", Alg: manager.method.Alg()}
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case *ecdsa.PublicKey:
+			size := (public.Curve.Params().BitSize + 7) / 8
+			jwk.Kty = "EC"
+			jwk.Crv = public.Curve.Params().Name
+			jwk.X = base64.RawURLEncoding.EncodeToString(public.X.FillBytes(make([]byte, size)))
+			jwk.Y = base64.RawURLEncoding.EncodeToString(public.Y.FillBytes(make([]byte, size)))
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
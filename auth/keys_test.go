@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+func testClaims() jwt.Claims {
+	return jwt.StandardClaims{Subject: "user", ExpiresAt: time.Now().Add(time.Minute).Unix()}
+}
+
+// parseToken: valida el token con Keyfunc y retorna el error que retornó Keyfunc
+func parseToken(manager *KeyManager, tokenString string) error {
+	_, err := jwt.Parse(tokenString, manager.Keyfunc)
+	var validationErr *jwt.ValidationError
+	if errors.As(err, &validationErr) && validationErr.Inner != nil {
+		return validationErr.Inner
+	}
+	return err
+}
+
+func newTestKeyManager(t *testing.T, algorithm string, overlap time.Duration) *KeyManager {
+	t.Helper()
+	manager, err := NewKeyManager(KeyConfig{Algorithm: algorithm, Secret: "secret", Overlap: overlap})
+	if err != nil {
+		t.Fatalf("NewKeyManager(%s) error = %v", algorithm, err)
+	}
+	return manager
+}
+
+func TestKeyfunc(t *testing.T) {
+	manager := newTestKeyManager(t, RS256, time.Hour)
+	key := manager.keys[0]
+
+	der, err := x509.MarshalPKIXPublicKey(key.public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPem := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token func() (string, error)
+		want  error
+	}{
+		{"signed by the manager", func() (string, error) {
+			return manager.Sign(testClaims())
+		}, nil},
+		{"HS256 signed with the public key", func() (string, error) {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+			token.Header["kid"] = key.kid
+			return token.SignedString(publicPem)
+		}, ErrUnexpectedAlgorithm},
+		{"HS256 signed with the public key in DER", func() (string, error) {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+			token.Header["kid"] = key.kid
+			return token.SignedString(der)
+		}, ErrUnexpectedAlgorithm},
+		{"alg none", func() (string, error) {
+			token := jwt.NewWithClaims(jwt.SigningMethodNone, testClaims())
+			token.Header["kid"] = key.kid
+			return token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+		}, ErrUnexpectedAlgorithm},
+		{"other algorithm", func() (string, error) {
+			token := jwt.NewWithClaims(jwt.SigningMethodES256, testClaims())
+			token.Header["kid"] = key.kid
+			return token.SignedString(other)
+		}, ErrUnexpectedAlgorithm},
+		{"unknown kid", func() (string, error) {
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, testClaims())
+			token.Header["kid"] = "unknown"
+			return token.SignedString(key.private)
+		}, ErrUnknownKey},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tokenString, err := test.token()
+			if err != nil {
+				t.Fatalf("signing token: %v", err)
+			}
+			if err := parseToken(manager, tokenString); !errors.Is(err, test.want) {
+				t.Errorf("parse error = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestRotateKeepsPreviousKeyDuringOverlap(t *testing.T) {
+	tests := []struct {
+		name    string
+		overlap time.Duration
+		want    error
+	}{
+		{"within overlap", time.Hour, nil},
+		{"after overlap", 0, ErrUnknownKey},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			manager := newTestKeyManager(t, ES256, test.overlap)
+			previous, err := manager.Sign(testClaims())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := manager.Rotate(); err != nil {
+				t.Fatalf("Rotate() error = %v", err)
+			}
+			time.Sleep(time.Millisecond)
+
+			current, err := manager.Sign(testClaims())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := parseToken(manager, current); err != nil {
+				t.Errorf("token signed after rotation: error = %v, want nil", err)
+			}
+			if err := parseToken(manager, previous); !errors.Is(err, test.want) {
+				t.Errorf("token signed before rotation: error = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"net/mail"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	DEFAULT_PASSWORD_MIN_LENGTH = 8
+	// PASSWORD_MAX_BYTES: bcrypt solo usa los primeros 72 bytes de la contraseña
+	PASSWORD_MAX_BYTES = 72
+)
+
+var (
+	// ErrInvalidEmail: el correo no tiene el formato usuario@dominio
+	ErrInvalidEmail = errors.New("invalid email address")
+	// ErrBreachedPassword: la contraseña está en la lista de contraseñas filtradas
+	ErrBreachedPassword = errors.New("password is too common, it appears in known data breaches")
+)
+
+// breachedPasswords: contraseñas más comunes en filtraciones, siempre se rechazan
+//
+//go:embed breached_passwords.txt
+var breachedPasswords string
+
+// NormalizeEmail: quita los espacios y pasa el correo a minúsculas, los correos
+// se guardan normalizados para que el mismo correo no se registre dos veces
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// ValidateEmail: valida un correo ya normalizado, no se aceptan nombres ("Nombre <correo>")
+// y el dominio debe tener al menos un punto
+func ValidateEmail(email string) error {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || address.Name != "" {
+		return ErrInvalidEmail
+	}
+	_, domain, _ := strings.Cut(email, "@")
+	if !strings.Contains(strings.Trim(domain, "."), ".") {
+		return ErrInvalidEmail
+	}
+	return nil
+}
+
+// PasswordPolicy: requisitos de las contraseñas nuevas (registro, cambio y reset de contraseña)
+type PasswordPolicy struct {
+	MinLength int // en caracteres
+	breached  map[string]struct{}
+}
+
+// NewPasswordPolicy: breachedFile es un archivo opcional con una contraseña por línea que se suma
+// a la lista incluida, por ejemplo una lista de contraseñas filtradas descargada
+func NewPasswordPolicy(minLength int, breachedFile string) (*PasswordPolicy, error) {
+	if minLength <= 0 {
+		minLength = DEFAULT_PASSWORD_MIN_LENGTH
+	}
+	policy := &PasswordPolicy{MinLength: minLength, breached: map[string]struct{}{}}
+	policy.addBreached(bufio.NewScanner(strings.NewReader(breachedPasswords)))
+	if breachedFile == "" {
+		return policy, nil
+	}
+	file, err := os.Open(breachedFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	policy.addBreached(scanner)
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", breachedFile, err)
+	}
+	return policy, nil
+}
+
+func (policy *PasswordPolicy) addBreached(scanner *bufio.Scanner) {
+	for scanner.Scan() {
+		if password := strings.TrimSpace(scanner.Text()); password != "" {
+			policy.breached[strings.ToLower(password)] = struct{}{}
+		}
+	}
+}
+
+// Validate: retorna el motivo por el que la contraseña no cumple la policy, nil si la cumple
+func (policy *PasswordPolicy) Validate(password string) error {
+	if utf8.RuneCountInString(password) < policy.MinLength {
+		return fmt.Errorf("password must have at least %d characters", policy.MinLength)
+	}
+	if len(password) > PASSWORD_MAX_BYTES {
+		return fmt.Errorf("password must have at most %d bytes", PASSWORD_MAX_BYTES)
+	}
+	if _, ok := policy.breached[strings.ToLower(password)]; ok {
+		return ErrBreachedPassword
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package auth
+
+const (
+	ROLE_USER  = "user"
+	ROLE_ADMIN = "admin"
+)
+
+const (
+	// PERMISSION_MANAGE_USERS: listar, deshabilitar y habilitar usuarios
+	PERMISSION_MANAGE_USERS = "users:manage"
+	// PERMISSION_MODERATE_POSTS: borrar posts de cualquier usuario
+	PERMISSION_MODERATE_POSTS = "posts:moderate"
+	// PERMISSION_VIEW_METRICS: ver las métricas del servidor en /debug/vars
+	PERMISSION_VIEW_METRICS = "metrics:view"
+)
+
+// rolePermissions: permisos de cada rol, ROLE_USER solo puede operar sobre sus propios recursos
+var rolePermissions = map[string][]string{
+	ROLE_USER:  {},
+	ROLE_ADMIN: {PERMISSION_MANAGE_USERS, PERMISSION_MODERATE_POSTS, PERMISSION_VIEW_METRICS},
+}
+
+// ValidRole: indica si el rol existe
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// HasPermission: indica si el rol tiene el permiso
+func HasPermission(role string, permission string) bool {
+	for _, granted := range rolePermissions[role] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidToken: el token no está firmado por este servidor o es para otro propósito
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrExpiredToken: el token está bien firmado pero ya expiró
+	ErrExpiredToken = errors.New("expired token")
+)
+
+// PURPOSE_VERIFY_EMAIL: tokens de los links de verificación de correo
+const PURPOSE_VERIFY_EMAIL = "verify_email"
+
+// signedPayload: contenido de un token firmado, el propósito evita que un token
+// emitido para una acción se use en otra
+type signedPayload struct {
+	Purpose   string `json:"p"`
+	Subject   string `json:"sub"`
+	Value     string `json:"v,omitempty"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Signer: tokens opacos firmados con HMAC-SHA256 que no se guardan en la base de datos,
+// son distintos de los access tokens para que no se puedan usar para autenticarse
+type Signer struct {
+	secret []byte
+}
+
+// NewSigner: con secret vacío se genera un secreto aleatorio, los tokens emitidos
+// dejan de ser válidos al reiniciar el servidor
+func NewSigner(secret string) (*Signer, error) {
+	if secret != "" {
+		return &Signer{secret: []byte(secret)}, nil
+	}
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	return &Signer{secret: random}, nil
+}
+
+// Sign: token para purpose sobre subject (por ejemplo el id del usuario) y un valor asociado
+// (por ejemplo su correo, así el token deja de servir si el correo cambia)
+func (signer *Signer) Sign(purpose string, subject string, value string, expiresAt time.Time) (string, error) {
+	data, err := json.Marshal(signedPayload{Purpose: purpose, Subject: subject, Value: value, ExpiresAt: expiresAt.Unix()})
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(signer.mac(payload)), nil
+}
+
+// Verify: valida la firma, el propósito y la expiración, retorna subject y value
+func (signer *Signer) Verify(purpose string, token string) (string, string, error) {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", "", ErrInvalidToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, signer.mac(payload)) {
+		return "", "", ErrInvalidToken
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", "", ErrInvalidToken
+	}
+	var decoded signedPayload
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.Purpose != purpose {
+		return "", "", ErrInvalidToken
+	}
+	if time.Now().Unix() > decoded.ExpiresAt {
+		return "", "", ErrExpiredToken
+	}
+	return decoded.Subject, decoded.Value, nil
+}
+
+func (signer *Signer) mac(payload string) []byte {
+	h := hmac.New(sha256.New, signer.secret)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
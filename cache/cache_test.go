@@ -0,0 +1,111 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(ctx context.Context, c *LRU)
+		present []string
+		evicted []string
+	}{
+		{
+			name: "oldest key",
+			setup: func(ctx context.Context, c *LRU) {
+				c.Set(ctx, "a", []byte("1"), time.Minute)
+				c.Set(ctx, "b", []byte("2"), time.Minute)
+				c.Set(ctx, "c", []byte("3"), time.Minute)
+			},
+			present: []string{"b", "c"},
+			evicted: []string{"a"},
+		},
+		{
+			name: "get marks key as used",
+			setup: func(ctx context.Context, c *LRU) {
+				c.Set(ctx, "a", []byte("1"), time.Minute)
+				c.Set(ctx, "b", []byte("2"), time.Minute)
+				c.Get(ctx, "a")
+				c.Set(ctx, "c", []byte("3"), time.Minute)
+			},
+			present: []string{"a", "c"},
+			evicted: []string{"b"},
+		},
+		{
+			name: "set existing key marks it as used",
+			setup: func(ctx context.Context, c *LRU) {
+				c.Set(ctx, "a", []byte("1"), time.Minute)
+				c.Set(ctx, "b", []byte("2"), time.Minute)
+				c.Set(ctx, "a", []byte("3"), time.Minute)
+				c.Set(ctx, "c", []byte("4"), time.Minute)
+			},
+			present: []string{"a", "c"},
+			evicted: []string{"b"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			c := NewLRU(2)
+			test.setup(ctx, c)
+			for _, key := range test.present {
+				if _, ok, _ := c.Get(ctx, key); !ok {
+					t.Errorf("Get(%q) missing, want present", key)
+				}
+			}
+			for _, key := range test.evicted {
+				if _, ok, _ := c.Get(ctx, key); ok {
+					t.Errorf("Get(%q) present, want evicted", key)
+				}
+			}
+		})
+	}
+}
+
+func TestLRUExpiresEntries(t *testing.T) {
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		want bool
+	}{
+		{"not expired", time.Minute, true},
+		{"expired", -time.Second, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			c := NewLRU(10)
+			c.Set(ctx, "key", []byte("value"), test.ttl)
+			value, ok, err := c.Get(ctx, "key")
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if ok != test.want {
+				t.Fatalf("Get() ok = %v, want %v", ok, test.want)
+			}
+			if ok && string(value) != "value" {
+				t.Errorf("Get() = %q, want \"value\"", value)
+			}
+			if !ok && len(c.items) != 0 {
+				t.Errorf("expired entry still stored, %d items", len(c.items))
+			}
+		})
+	}
+}
+
+func TestLRUDeletePrefix(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(10)
+	for _, key := range []string{"post:1", "post:2", "posts:list"} {
+		c.Set(ctx, key, []byte("x"), time.Minute)
+	}
+	c.DeletePrefix(ctx, "post:")
+	for key, want := range map[string]bool{"post:1": false, "post:2": false, "posts:list": true} {
+		if _, ok, _ := c.Get(ctx, key); ok != want {
+			t.Errorf("Get(%q) ok = %v, want %v", key, ok, want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+	"w00k/go/rest-ws/auth"
+	"w00k/go/rest-ws/database"
+	"w00k/go/rest-ws/repository"
+	"w00k/go/rest-ws/transfer"
+)
+
+// runCommand: ejecuta un subcomando en lugar de levantar el servidor
+// - export [archivo]: exporta usuarios y posts en NDJSON al archivo o a la salida estándar
+// - import [archivo]: importa usuarios y posts en NDJSON desde el archivo o la entrada estándar
+// - bootstrap-admin email: asigna el rol de administrador a un usuario ya registrado
+func runCommand(command string, args []string, config database.Config) error {
+	var run func(ctx context.Context, repo repository.Repository) error
+	switch command {
+	case "export", "import":
+		if len(args) > 1 {
+			return errors.New("usage: " + command + " [file]")
+		}
+		run = func(ctx context.Context, repo repository.Repository) error {
+			return runTransfer(ctx, repo, command, args)
+		}
+	case "bootstrap-admin":
+		if len(args) != 1 {
+			return errors.New("usage: bootstrap-admin email")
+		}
+		run = func(ctx context.Context, repo repository.Repository) error {
+			return bootstrapAdmin(ctx, repo, args[0])
+		}
+	default:
+		return fmt.Errorf("unknown command %q, available commands: export, import, bootstrap-admin", command)
+	}
+	ctx := context.Background()
+	repo, err := database.NewPostgresRepository(ctx, config)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+	return run(ctx, repo)
+}
+
+func runTransfer(ctx context.Context, repo repository.Repository, command string, args []string) error {
+	options := transfer.Options{
+		BatchSize: intEnv("TRANSFER_BATCH_SIZE"),
+		OnProgress: func(progress transfer.Progress) {
+			log.Printf("%s: %d users, %d posts, %d revisions\n", command, progress.Users, progress.Posts, progress.Revisions)
+		},
+	}
+	var progress transfer.Progress
+	var err error
+	if command == "export" {
+		var w io.Writer = os.Stdout
+		if len(args) == 1 {
+			file, err := os.Create(args[0])
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			w = file
+		}
+		progress, err = transfer.Export(ctx, repo, w, options)
+	} else {
+		var r io.Reader = os.Stdin
+		if len(args) == 1 {
+			file, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			r = file
+		}
+		progress, err = transfer.Import(ctx, repo, r, options)
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("%s finished: %d users, %d posts, %d revisions\n", command, progress.Users, progress.Posts, progress.Revisions)
+	return nil
+}
+
+// bootstrapAdmin: crea el primer administrador a partir de un usuario registrado con /signup,
+// se revocan sus tokens para que el próximo login incluya el rol
+func bootstrapAdmin(ctx context.Context, repo repository.Repository, email string) error {
+	user, err := repo.GetUserByEmail(ctx, auth.NormalizeEmail(email))
+	if err != nil {
+		return err
+	}
+	if user == nil || user.Id == "" {
+		return fmt.Errorf("user %s not found, sign up first", email)
+	}
+	err = repo.WithTx(ctx, func(tx repository.Repository) error {
+		if err := tx.SetUserRole(ctx, user.Id, auth.ROLE_ADMIN); err != nil {
+			return err
+		}
+		return tx.RevokeUserTokens(ctx, user.Id, time.Now())
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("bootstrap-admin: %s (%s) is now %s\n", email, user.Id, auth.ROLE_ADMIN)
+	return nil
+}
@@ -0,0 +1,174 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	PING_TIMEOUT                  = 2 * time.Second
+	DEFAULT_HEALTH_CHECK_INTERVAL = 10 * time.Second
+	DEFAULT_MAX_OPEN_CONNS        = 25
+	DEFAULT_MAX_IDLE_CONNS        = 10
+	DEFAULT_CONN_MAX_LIFETIME     = 30 * time.Minute
+	DEFAULT_CONN_MAX_IDLE_TIME    = 5 * time.Minute
+	DEFAULT_CONNECT_RETRIES       = 5
+	DEFAULT_CONNECT_BACKOFF       = 500 * time.Millisecond
+	DEFAULT_MAX_CONNECT_BACKOFF   = 10 * time.Second
+)
+
+// Config: configuración de la conexión a Postgres
+// - Url: base de datos primaria, recibe todas las escrituras
+// - ReplicaUrls: réplicas de lectura para GetPostById, ListPost y GetUserById
+// - ReadYourWrites: si es true, después de escribir el request lee desde el primario
+// - HealthCheckInterval: cada cuánto se revisa el estado del primario y las réplicas
+// - MaxOpenConns, MaxIdleConns, ConnMaxLifetime, ConnMaxIdleTime: pool de conexiones de cada base de datos
+// - ConnectRetries, ConnectBackoff, MaxConnectBackoff: reintentos con backoff exponencial al conectarse al primario
+// los valores en cero usan los valores por defecto
+type Config struct {
+	Url                 string
+	ReplicaUrls         []string
+	ReadYourWrites      bool
+	HealthCheckInterval time.Duration
+	MaxOpenConns        int
+	MaxIdleConns        int
+	ConnMaxLifetime     time.Duration
+	ConnMaxIdleTime     time.Duration
+	ConnectRetries      int
+	ConnectBackoff      time.Duration
+	MaxConnectBackoff   time.Duration
+}
+
+func (config *Config) setDefaults() {
+	if config.HealthCheckInterval <= 0 {
+		config.HealthCheckInterval = DEFAULT_HEALTH_CHECK_INTERVAL
+	}
+	if config.MaxOpenConns <= 0 {
+		config.MaxOpenConns = DEFAULT_MAX_OPEN_CONNS
+	}
+	if config.MaxIdleConns <= 0 {
+		config.MaxIdleConns = DEFAULT_MAX_IDLE_CONNS
+	}
+	if config.ConnMaxLifetime <= 0 {
+		config.ConnMaxLifetime = DEFAULT_CONN_MAX_LIFETIME
+	}
+	if config.ConnMaxIdleTime <= 0 {
+		config.ConnMaxIdleTime = DEFAULT_CONN_MAX_IDLE_TIME
+	}
+	if config.ConnectRetries <= 0 {
+		config.ConnectRetries = DEFAULT_CONNECT_RETRIES
+	}
+	if config.ConnectBackoff <= 0 {
+		config.ConnectBackoff = DEFAULT_CONNECT_BACKOFF
+	}
+	if config.MaxConnectBackoff <= 0 {
+		config.MaxConnectBackoff = DEFAULT_MAX_CONNECT_BACKOFF
+	}
+}
+
+// node: conexión a una base de datos (primario o réplica) y su último estado conocido
+// (healthy: 1 sana, 0 con errores, -1 sin revisar)
+type node struct {
+	name    string
+	db      *sql.DB
+	healthy int32
+}
+
+// openNode: abre el pool de conexiones, el nombre evita registrar la url que contiene las credenciales
+func openNode(name string, url string, config Config) (*node, error) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(config.MaxOpenConns)
+	db.SetMaxIdleConns(config.MaxIdleConns)
+	db.SetConnMaxLifetime(config.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(config.ConnMaxIdleTime)
+	return &node{name: name, db: db, healthy: -1}, nil
+}
+
+func (n *node) isHealthy() bool {
+	return atomic.LoadInt32(&n.healthy) == 1
+}
+
+// ping: revisa la conexión y registra en el log los cambios de estado
+func (n *node) ping(ctx context.Context) error {
+	pingCtx, cancel := context.WithTimeout(ctx, PING_TIMEOUT)
+	defer cancel()
+	err := n.db.PingContext(pingCtx)
+	healthy := int32(0)
+	if err == nil {
+		healthy = 1
+	}
+	if previous := atomic.SwapInt32(&n.healthy, healthy); previous != healthy {
+		if err != nil {
+			log.Printf("database %s is unhealthy: %v\n", n.name, err)
+		} else {
+			log.Printf("database %s is healthy\n", n.name)
+		}
+	}
+	return err
+}
+
+// connect: espera a que la base de datos responda, reintentando con backoff exponencial
+func (n *node) connect(ctx context.Context, config Config) error {
+	backoff := config.ConnectBackoff
+	for attempt := 1; ; attempt++ {
+		err := n.ping(ctx)
+		if err == nil {
+			return nil
+		}
+		if attempt > config.ConnectRetries {
+			return fmt.Errorf("database %s unreachable after %d attempts: %w", n.name, attempt, err)
+		}
+		log.Printf("database %s not ready (attempt %d), retrying in %s\n", n.name, attempt, backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > config.MaxConnectBackoff {
+			backoff = config.MaxConnectBackoff
+		}
+	}
+}
+
+// monitor: revisa periódicamente el estado del primario y de las réplicas, las réplicas
+// con errores dejan de recibir lecturas hasta que vuelvan a responder
+func (repo *PostgresRepository) monitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			repo.primary.ping(ctx)
+			for _, replica := range repo.replicas.nodes() {
+				replica.ping(ctx)
+			}
+		}
+	}
+}
+
+// Healthy: indica si el primario respondió en la última revisión
+func (repo *PostgresRepository) Healthy() bool {
+	return repo.primary.isHealthy()
+}
+
+// Stats: estado y estadísticas del pool de conexiones del primario y de cada réplica
+func (repo *PostgresRepository) Stats() map[string]interface{} {
+	stats := map[string]interface{}{}
+	for _, n := range append([]*node{repo.primary}, repo.replicas.nodes()...) {
+		stats[n.name] = map[string]interface{}{
+			"healthy": n.isHealthy(),
+			"pool":    n.db.Stats(),
+		}
+	}
+	return stats
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"w00k/go/rest-ws/models"
+	"w00k/go/rest-ws/repository"
+)
+
+// MAX_BACKOFF_EXPONENT: límite del exponente del backoff para que power() no se desborde,
+// el bloqueo igual queda limitado por Lockout
+const MAX_BACKOFF_EXPONENT = 60
+
+// ReserveLoginAttempt: cuenta el intento de login de la key como fallido antes de validar la contraseña,
+// si con este intento se supera MaxAttempts la key queda bloqueada en la misma sentencia, así los
+// intentos concurrentes no pueden pasar todos antes de que se registre el primer fallo
+// los casos que soporta son:
+// - reserva el intento, retorna los intentos de la key (LockedUntil no es nil si este intento la bloqueó)
+// - la key está bloqueada, retorna los intentos de la key y repository.ErrLoginLocked
+// - error al reservar el intento, retorna nil y el error
+func (repo *PostgresRepository) ReserveLoginAttempt(ctx context.Context, key string, limit repository.LoginLimit) (*models.LoginAttempt, error) {
+	//failures se repite porque en el SET las columnas tienen el valor anterior al update
+	const failures = "CASE WHEN login_attempts.last_failure_at < NOW() - make_interval(secs => $4) THEN 1 ELSE login_attempts.failures + 1 END"
+	var attempt = models.LoginAttempt{Key: key}
+	var lockedUntil sql.NullTime
+	err := repo.writer(ctx).QueryRowContext(ctx, `INSERT INTO login_attempts (key, failures, last_failure_at) VALUES ($1, 1, NOW())
+		ON CONFLICT (key) DO UPDATE SET
+		failures = `+failures+`,
+		last_failure_at = NOW(),
+		locked_until = CASE WHEN `+failures+` > $2
+			THEN NOW() + make_interval(secs => LEAST($3 * power(2, LEAST(`+failures+` - $2 - 1, $5)), $4))
+			ELSE NULL END
+		WHERE login_attempts.locked_until IS NULL OR login_attempts.locked_until <= NOW()
+		RETURNING failures, last_failure_at, locked_until`,
+		key, limit.MaxAttempts, limit.Backoff.Seconds(), limit.Lockout.Seconds(), MAX_BACKOFF_EXPONENT).
+		Scan(&attempt.Failures, &attempt.LastFailureAt, &lockedUntil)
+	if err == sql.ErrNoRows {
+		//el WHERE del update no se cumplió, la key ya estaba bloqueada
+		err = repo.writer(ctx).QueryRowContext(ctx, "SELECT failures, last_failure_at, locked_until FROM login_attempts WHERE key = $1", key).
+			Scan(&attempt.Failures, &attempt.LastFailureAt, &lockedUntil)
+		if err != nil {
+			return nil, err
+		}
+		attempt.LockedUntil = nullTime(lockedUntil)
+		return &attempt, repository.ErrLoginLocked
+	}
+	if err != nil {
+		return nil, err
+	}
+	attempt.LockedUntil = nullTime(lockedUntil)
+	return &attempt, nil
+}
+
+// ReleaseLoginAttempt: descuenta un intento reservado con ReserveLoginAttempt que no falló,
+// por ejemplo el de la ip cuando el login es exitoso
+func (repo *PostgresRepository) ReleaseLoginAttempt(ctx context.Context, key string) error {
+	_, err := repo.writer(ctx).ExecContext(ctx, "UPDATE login_attempts SET failures = GREATEST(failures - 1, 0) WHERE key = $1", key)
+	return err
+}
+
+// ResetLoginAttempts: borra los intentos fallidos de la key, se llama después de un login exitoso
+func (repo *PostgresRepository) ResetLoginAttempts(ctx context.Context, key string) error {
+	_, err := repo.writer(ctx).ExecContext(ctx, "DELETE FROM login_attempts WHERE key = $1", key)
+	return err
+}
+
+// PurgeLoginAttempts: elimina los intentos cuyo último fallo fue antes de before y que ya no están
+// bloqueados, retorna la cantidad de registros eliminados
+func (repo *PostgresRepository) PurgeLoginAttempts(ctx context.Context, before time.Time) (int64, error) {
+	result, err := repo.writer(ctx).ExecContext(ctx, "DELETE FROM login_attempts WHERE last_failure_at < $1 AND (locked_until IS NULL OR locked_until < NOW())", before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
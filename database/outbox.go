@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+	"w00k/go/rest-ws/models"
+
+	"github.com/lib/pq"
+)
+
+// InsertOutboxEvent: inserción de un evento en el outbox
+// los casos que soporta son:
+// - inserta el evento, retorna nil y asigna el id al evento
+// - error al insertar el evento, retorna el error
+func (repo *PostgresRepository) InsertOutboxEvent(ctx context.Context, event *models.OutboxEvent) error {
+	return repo.writer(ctx).QueryRowContext(ctx, "INSERT INTO outbox (event_type, payload) VALUES ($1, $2) RETURNING id, created_at", event.Type, []byte(event.Payload)).Scan(&event.Id, &event.CreatedAt)
+}
+
+// ClaimOutboxEvents: toma hasta limit eventos no entregados ni tomados por otro relay, en orden de
+// inserción, y los reserva durante lease; la reserva es una sola sentencia, así el relay publica
+// fuera de una transacción y si se cae los eventos se vuelven a publicar cuando vence la reserva
+func (repo *PostgresRepository) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxEvent, error) {
+	rows, err := repo.writer(ctx).QueryContext(ctx, `UPDATE outbox SET claimed_until = NOW() + make_interval(secs => $2)
+		WHERE id IN (
+			SELECT id FROM outbox WHERE delivered_at IS NULL AND (claimed_until IS NULL OR claimed_until < NOW())
+			ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, event_type, payload, created_at`, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = rows.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	var events []*models.OutboxEvent
+	for rows.Next() {
+		var event = models.OutboxEvent{}
+		var payload []byte
+		if err = rows.Scan(&event.Id, &event.Type, &payload, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		event.Payload = payload
+		events = append(events, &event)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	//RETURNING no respeta el ORDER BY de la subconsulta
+	sort.Slice(events, func(i, j int) bool { return events[i].Id < events[j].Id })
+	return events, nil
+}
+
+// MarkOutboxEventsDelivered: marca los eventos como entregados
+func (repo *PostgresRepository) MarkOutboxEventsDelivered(ctx context.Context, ids []int64) error {
+	_, err := repo.writer(ctx).ExecContext(ctx, "UPDATE outbox SET delivered_at = NOW() WHERE id = ANY($1)", pq.Array(ids))
+	return err
+}
+
+// DeleteDeliveredOutboxEvents: borra los eventos entregados antes de la fecha indicada,
+// retorna la cantidad de eventos borrados
+func (repo *PostgresRepository) DeleteDeliveredOutboxEvents(ctx context.Context, before time.Time) (int64, error) {
+	result, err := repo.writer(ctx).ExecContext(ctx, "DELETE FROM outbox WHERE delivered_at < $1", before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
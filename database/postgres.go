@@ -3,28 +3,88 @@ package database
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"log"
-	"os"
-	"strconv"
+	"strings"
+	"time"
 	"w00k/go/rest-ws/models"
+	"w00k/go/rest-ws/repository"
 
-	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
 
-var configMap = make(map[string]int)
+// querier: operaciones comunes entre *sql.DB y *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
 
+// PostgresRepository: implementación del repositorio en Postgres, conn es la
+// base de datos o la transacción en curso si el repositorio se obtuvo con WithTx
 type PostgresRepository struct {
-	db *sql.DB
+	db             *sql.DB
+	conn           querier
+	tx             *sql.Tx
+	depth          int
+	primary        *node
+	replicas       *replicaSet
+	readYourWrites bool
+	stop           context.CancelFunc
 }
 
-// NewPostgresRepository: conexión a la base de datos
-func NewPostgresRepository(url string) (*PostgresRepository, error) {
-	db, err := sql.Open("postgres", url)
+// NewPostgresRepository: conexión a la base de datos y a las réplicas de lectura
+// los casos que soporta son:
+// - el primario responde (reintentando según la configuración), retorna el repositorio
+// - el primario no responde después de los reintentos o se cancela ctx, retorna el error
+// - las réplicas que no responden no impiden iniciar, quedan fuera hasta que respondan
+func NewPostgresRepository(ctx context.Context, config Config) (*PostgresRepository, error) {
+	config.setDefaults()
+	primary, err := openNode("primary", config.Url, config)
 	if err != nil {
 		return nil, err
 	}
-	return &PostgresRepository{db}, nil
+	if err := primary.connect(ctx, config); err != nil {
+		primary.db.Close()
+		return nil, err
+	}
+	repo := &PostgresRepository{db: primary.db, conn: primary.db, primary: primary, readYourWrites: config.ReadYourWrites}
+	if len(config.ReplicaUrls) > 0 {
+		repo.replicas = &replicaSet{}
+		for i, url := range config.ReplicaUrls {
+			replica, err := openNode(fmt.Sprintf("replica-%d", i), url, config)
+			if err != nil {
+				repo.Close()
+				return nil, err
+			}
+			replica.ping(ctx)
+			repo.replicas.replicas = append(repo.replicas.replicas, replica)
+		}
+	}
+	monitorCtx, cancel := context.WithCancel(context.Background())
+	repo.stop = cancel
+	go repo.monitor(monitorCtx, config.HealthCheckInterval)
+	return repo, nil
+}
+
+// reader: conexión para las lecturas que toleran réplicas, se usa el primario si hay una transacción
+// en curso, si el request ya escribió (con ReadYourWrites), si el contexto lo pide (repository.WithPrimary)
+// o si no hay réplicas sanas
+func (repo *PostgresRepository) reader(ctx context.Context) querier {
+	if repo.tx != nil || repository.ReadsPrimary(ctx) || (repo.readYourWrites && repository.HasWritten(ctx)) {
+		return repo.conn
+	}
+	if replica := repo.replicas.pick(); replica != nil {
+		return replica
+	}
+	return repo.conn
+}
+
+// writer: conexión para las escrituras, registra la escritura en el contexto del request
+func (repo *PostgresRepository) writer(ctx context.Context) querier {
+	repository.MarkWritten(ctx)
+	return repo.conn
 }
 
 // InsertUser: inserción de un usuario a la base de datos
@@ -32,17 +92,94 @@ func NewPostgresRepository(url string) (*PostgresRepository, error) {
 // - inserta el user, retorna nil
 // - error al insertar el usuario, retorna el error
 func (repo *PostgresRepository) InsertUser(ctx context.Context, user *models.User) error {
-	_, err := repo.db.ExecContext(ctx, "INSERT INTO users (id, email, password) VALUES ($1, $2, $3)", user.Id, user.Email, user.Password)
+	_, err := repo.writer(ctx).ExecContext(ctx, "INSERT INTO users (id, email, password) VALUES ($1, $2, $3)", user.Id, user.Email, user.Password)
 	return err
 }
 
+// UpdateUserPassword: reemplaza el hash de la contraseña del usuario
+// los casos que soporta son:
+// - actualiza la contraseña, retorna nil
+// - el usuario no existe, retorna repository.ErrNotFound
+// - error al actualizar la contraseña, retorna el error
+func (repo *PostgresRepository) UpdateUserPassword(ctx context.Context, userId string, password string) error {
+	result, err := repo.writer(ctx).ExecContext(ctx, "UPDATE users SET password = $2 WHERE id = $1", userId, password)
+	if err != nil {
+		return err
+	}
+	return checkUserAffected(result)
+}
+
+// SetUserRole: asigna el rol al usuario
+// los casos que soporta son:
+// - asigna el rol, retorna nil
+// - el usuario no existe, retorna repository.ErrNotFound
+// - error al actualizar el usuario, retorna el error
+func (repo *PostgresRepository) SetUserRole(ctx context.Context, userId string, role string) error {
+	result, err := repo.writer(ctx).ExecContext(ctx, "UPDATE users SET role = $2 WHERE id = $1", userId, role)
+	if err != nil {
+		return err
+	}
+	return checkUserAffected(result)
+}
+
+// SetUserDisabled: deshabilita o vuelve a habilitar al usuario
+// los casos que soporta son:
+// - actualiza el usuario, retorna nil
+// - el usuario no existe, retorna repository.ErrNotFound
+// - error al actualizar el usuario, retorna el error
+func (repo *PostgresRepository) SetUserDisabled(ctx context.Context, userId string, disabled bool) error {
+	query := "UPDATE users SET disabled_at = NULL WHERE id = $1"
+	if disabled {
+		query = "UPDATE users SET disabled_at = COALESCE(disabled_at, NOW()) WHERE id = $1"
+	}
+	result, err := repo.writer(ctx).ExecContext(ctx, query, userId)
+	if err != nil {
+		return err
+	}
+	return checkUserAffected(result)
+}
+
+// MarkEmailVerified: marca el correo del usuario como verificado, el correo debe ser el mismo
+// para el que se emitió el link de verificación
+// los casos que soporta son:
+// - marca el correo como verificado (o ya estaba verificado), retorna nil
+// - el usuario no existe o cambió su correo, retorna repository.ErrNotFound
+// - error al actualizar el usuario, retorna el error
+func (repo *PostgresRepository) MarkEmailVerified(ctx context.Context, userId string, email string) error {
+	result, err := repo.writer(ctx).ExecContext(ctx, "UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()) WHERE id = $1 AND email = $2", userId, email)
+	if err != nil {
+		return err
+	}
+	return checkUserAffected(result)
+}
+
+// checkUserAffected: un update de un usuario que no afecta filas es porque el usuario no existe
+func checkUserAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+// nullTime: convierte una fecha que puede ser NULL en un puntero
+func nullTime(value sql.NullTime) *time.Time {
+	if !value.Valid {
+		return nil
+	}
+	return &value.Time
+}
+
 // GetUserById: obtiene el ususario por el id el usuario,
 // los casos que soporta son:
 // - obtiene el usuario, lo retorna
 // - en caso de error, retorna un objeto usuario vacio y el error
 // - en caso de no encontrar el usuario, retorna un objeto usuario vacio y el error en nil
 func (repo *PostgresRepository) GetUserById(ctx context.Context, id string) (*models.User, error) {
-	rows, err := repo.db.QueryContext(ctx, "SELECT id, email FROM users WHERE id = $1", id)
+	rows, err := repo.reader(ctx).QueryContext(ctx, "SELECT id, email, created_at, role, disabled_at, email_verified_at FROM users WHERE id = $1", id)
 
 	defer func() {
 		err = rows.Close()
@@ -53,7 +190,10 @@ func (repo *PostgresRepository) GetUserById(ctx context.Context, id string) (*mo
 
 	var user = models.User{}
 	for rows.Next() {
-		if err = rows.Scan(&user.Id, &user.Email); err == nil {
+		var disabledAt, emailVerifiedAt sql.NullTime
+		if err = rows.Scan(&user.Id, &user.Email, &user.CreatedAt, &user.Role, &disabledAt, &emailVerifiedAt); err == nil {
+			user.DisabledAt = nullTime(disabledAt)
+			user.EmailVerifiedAt = nullTime(emailVerifiedAt)
 			return &user, nil
 		}
 	}
@@ -63,13 +203,14 @@ func (repo *PostgresRepository) GetUserById(ctx context.Context, id string) (*mo
 	return &user, nil
 }
 
-// GetUserByEmail: obtiene el ususario por el id el usuario,
+// GetUserByEmail: obtiene el ususario por su correo sin importar mayúsculas, así también se encuentran
+// los usuarios que se registraron antes de que los correos se guardaran normalizados,
 // los casos que soporta son:
 // - obtiene el usuario, lo retorna
 // - en caso de error, retorna un objeto usuario vacio y el error
 // - en caso de no encontrar el usuario, retorna un objeto usuario vacio y el error en nil
 func (repo *PostgresRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
-	rows, err := repo.db.QueryContext(ctx, "SELECT id, email, password FROM users WHERE email = $1", email)
+	rows, err := repo.conn.QueryContext(ctx, "SELECT id, email, password, created_at, role, disabled_at, email_verified_at FROM users WHERE lower(email) = lower($1)", email)
 
 	defer func() {
 		err = rows.Close()
@@ -80,7 +221,10 @@ func (repo *PostgresRepository) GetUserByEmail(ctx context.Context, email string
 
 	var user = models.User{}
 	for rows.Next() {
-		if err = rows.Scan(&user.Id, &user.Email, &user.Password); err == nil {
+		var disabledAt, emailVerifiedAt sql.NullTime
+		if err = rows.Scan(&user.Id, &user.Email, &user.Password, &user.CreatedAt, &user.Role, &disabledAt, &emailVerifiedAt); err == nil {
+			user.DisabledAt = nullTime(disabledAt)
+			user.EmailVerifiedAt = nullTime(emailVerifiedAt)
 			return &user, nil
 		}
 	}
@@ -92,65 +236,206 @@ func (repo *PostgresRepository) GetUserByEmail(ctx context.Context, email string
 
 // InsertPost: inserción de un post a la base de datos
 // los casos que soporta son:
-// - inserta el post, retorna nil
+// - inserta el post, retorna nil y asigna la fecha de creación y la versión al post
 // - error al insertar el post, retorna el error
 func (repo *PostgresRepository) InsertPost(ctx context.Context, post *models.Post) error {
-	_, err := repo.db.ExecContext(ctx, "INSERT INTO posts (id, post_content, user_id) VALUES ($1, $2, $3)", post.Id, post.PostContent, post.UserId)
-	return err
+	return repo.writer(ctx).QueryRowContext(ctx, "INSERT INTO posts (id, post_content, user_id) VALUES ($1, $2, $3) RETURNING created_at, version", post.Id, post.PostContent, post.UserId).Scan(&post.CreateAt, &post.Version)
 }
 
 func (repo *PostgresRepository) Close() error {
+	if repo.tx != nil {
+		return errors.New("cannot close the repository inside a transaction")
+	}
+	if repo.stop != nil {
+		repo.stop()
+	}
+	for _, replica := range repo.replicas.nodes() {
+		if err := replica.db.Close(); err != nil {
+			log.Println(err)
+		}
+	}
 	return repo.db.Close()
 }
 
-// GetPostById: obtiene el post por el id el post,
+// GetPostById: obtiene el post por el id el post, los posts borrados no se consideran
 // los casos que soporta son:
 // - obtiene el post, lo retorna
-// - en caso de error, retorna un objeto post vacio y el error
-// - en caso de no encontrar el post, retorna un objeto post vacio y el error en nil
+// - en caso de error, retorna nil y el error
+// - en caso de no encontrar el post, retorna nil y repository.ErrNotFound
 func (repo *PostgresRepository) GetPostById(ctx context.Context, id string) (*models.Post, error) {
-	rows, err := repo.db.QueryContext(ctx, "SELECT id, post_content, created_at, user_id FROM posts WHERE id = $1", id)
-
-	defer func() {
-		err = rows.Close()
-		if err != nil {
-			log.Fatal(err)
-		}
-	}()
-
 	var post = models.Post{}
-	for rows.Next() {
-		if err = rows.Scan(&post.Id, &post.PostContent, &post.CreateAt, post.UserId); err == nil {
-			return &post, nil
-		}
+	err := repo.reader(ctx).QueryRowContext(ctx, "SELECT id, post_content, created_at, user_id, version FROM posts WHERE id = $1 AND deleted_at IS NULL", id).Scan(&post.Id, &post.PostContent, &post.CreateAt, &post.UserId, &post.Version)
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrNotFound
 	}
-	if err = rows.Err(); err != nil {
+	if err != nil {
 		return nil, err
 	}
 	return &post, nil
 }
 
-// UpdatePost: update de un post a la base de datos
+// UpdatePost: update de un post a la base de datos, si post.Version no es 0 solo se actualiza
+// si el post sigue en esa versión, al actualizar se incrementa la versión y se asigna a post.Version
 // los casos que soporta son:
 // - actualiza el post, retorna nil
+// - el post no existe, retorna repository.ErrNotFound
+// - el post pertenece a otro usuario, retorna repository.ErrForbidden
+// - el post está en otra versión, retorna repository.ErrVersionMismatch
 // - error al actualizar el post, retorna el error
 func (repo *PostgresRepository) UpdatePost(ctx context.Context, post *models.Post) error {
-	_, err := repo.db.ExecContext(ctx, "UPDATE posts SET post_content = $2 WHERE id = $1 and user_id = $3", post.Id, post.PostContent, post.UserId)
-	return err
+	err := repo.writer(ctx).QueryRowContext(ctx, "UPDATE posts SET post_content = $2, version = version + 1 WHERE id = $1 and user_id = $3 AND deleted_at IS NULL AND ($4 = 0 OR version = $4) RETURNING version", post.Id, post.PostContent, post.UserId, post.Version).Scan(&post.Version)
+	if err != sql.ErrNoRows {
+		return err
+	}
+	var owner string
+	err = repo.conn.QueryRowContext(ctx, "SELECT user_id FROM posts WHERE id = $1 AND deleted_at IS NULL", post.Id).Scan(&owner)
+	switch {
+	case err == sql.ErrNoRows:
+		return repository.ErrNotFound
+	case err != nil:
+		return err
+	case owner != post.UserId:
+		return repository.ErrForbidden
+	default:
+		return repository.ErrVersionMismatch
+	}
 }
 
-// DeletePost: borra un post a la base de datos
+// DeletePost: borra un post a la base de datos, el borrado es lógico (deleted_at) y
+// el post se elimina definitivamente con PurgeDeletedPosts
 // los casos que soporta son:
 // - borra el post, retorna nil
+// - el post no existe, retorna repository.ErrNotFound
+// - el post pertenece a otro usuario, retorna repository.ErrForbidden
 // - error al borrar el post, retorna el error
 func (repo *PostgresRepository) DeletePost(ctx context.Context, id string, userId string) error {
-	_, err := repo.db.ExecContext(ctx, "DELETE FROM posts WHERE id = $1 and user_id = $2", id, userId)
-	return err
+	result, err := repo.writer(ctx).ExecContext(ctx, "UPDATE posts SET deleted_at = NOW() WHERE id = $1 and user_id = $2 AND deleted_at IS NULL", id, userId)
+	if err != nil {
+		return err
+	}
+	return repo.checkPostOwnership(ctx, result, id)
+}
+
+// ForceDeletePost: borra un post sin importar su dueño (moderación), el borrado es lógico como en DeletePost
+// pero queda marcado con moderated_at y el dueño no puede restaurarlo; también se puede moderar
+// un post que el dueño ya borró, así no puede restaurarlo después
+// los casos que soporta son:
+// - borra el post, retorna nil
+// - el post no existe o ya fue moderado, retorna repository.ErrNotFound
+// - error al borrar el post, retorna el error
+func (repo *PostgresRepository) ForceDeletePost(ctx context.Context, id string) error {
+	result, err := repo.writer(ctx).ExecContext(ctx, "UPDATE posts SET deleted_at = COALESCE(deleted_at, NOW()), moderated_at = NOW() WHERE id = $1 AND moderated_at IS NULL", id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+// checkPostOwnership: cuando un update o delete filtrado por user_id no afecta
+// filas, determina si es porque el post no existe o porque es de otro usuario
+func (repo *PostgresRepository) checkPostOwnership(ctx context.Context, result sql.Result, id string) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected > 0 {
+		return nil
+	}
+	var exists bool
+	err = repo.conn.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM posts WHERE id = $1 AND deleted_at IS NULL)", id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return repository.ErrForbidden
+	}
+	return repository.ErrNotFound
+}
+
+// RestorePost: restaura un post borrado por su dueño, siempre que se haya borrado después de deletedAfter
+// los casos que soporta son:
+// - restaura el post, retorna nil
+// - el post no existe, retorna repository.ErrNotFound
+// - el post pertenece a otro usuario o lo borró un moderador, retorna repository.ErrForbidden
+// - el post no está borrado, retorna repository.ErrNotDeleted
+// - el post se borró antes de deletedAfter, retorna repository.ErrRestoreExpired
+func (repo *PostgresRepository) RestorePost(ctx context.Context, id string, userId string, deletedAfter time.Time) error {
+	result, err := repo.writer(ctx).ExecContext(ctx, "UPDATE posts SET deleted_at = NULL WHERE id = $1 AND user_id = $2 AND deleted_at >= $3 AND moderated_at IS NULL", id, userId, deletedAfter.UTC())
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil || affected > 0 {
+		return err
+	}
+	var owner string
+	var deletedAt, moderatedAt sql.NullTime
+	err = repo.conn.QueryRowContext(ctx, "SELECT user_id, deleted_at, moderated_at FROM posts WHERE id = $1", id).Scan(&owner, &deletedAt, &moderatedAt)
+	switch {
+	case err == sql.ErrNoRows:
+		return repository.ErrNotFound
+	case err != nil:
+		return err
+	case owner != userId || moderatedAt.Valid:
+		return repository.ErrForbidden
+	case !deletedAt.Valid:
+		return repository.ErrNotDeleted
+	default:
+		return repository.ErrRestoreExpired
+	}
 }
 
-func (repo *PostgresRepository) ListPost(ctx context.Context, page uint64) ([]*models.Post, error) {
-	pageSize := getPageSize()
-	rows, err := repo.db.QueryContext(ctx, "SELECT id, post_content, user_id, created_at FROM posts LIMIT $1 OFFSET $2", pageSize, page*uint64(pageSize))
+// PurgeDeletedPosts: elimina definitivamente los posts borrados antes de la fecha indicada,
+// retorna la cantidad de posts eliminados
+func (repo *PostgresRepository) PurgeDeletedPosts(ctx context.Context, before time.Time) (int64, error) {
+	result, err := repo.writer(ctx).ExecContext(ctx, "DELETE FROM posts WHERE deleted_at < $1", before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ListPost: lista los posts ordenados por created_at, id aplicando los filtros de options
+// los casos que soporta son:
+// - con cursor, retorna los posts que siguen al cursor (keyset)
+// - sin cursor, retorna la página indicada usando offset
+// - en caso de error, retorna el error
+func (repo *PostgresRepository) ListPost(ctx context.Context, options repository.ListPostOptions) ([]*models.Post, error) {
+	conditions := []string{"deleted_at IS NULL"}
+	var args []interface{}
+	param := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	comparator, direction := ">", "ASC"
+	if options.Sort == repository.SortNewest {
+		comparator, direction = "<", "DESC"
+	}
+	if options.UserId != "" {
+		conditions = append(conditions, "user_id = "+param(options.UserId))
+	}
+	if options.Since != nil {
+		conditions = append(conditions, "created_at >= "+param(options.Since.UTC()))
+	}
+	if options.Until != nil {
+		conditions = append(conditions, "created_at <= "+param(options.Until.UTC()))
+	}
+	if options.After != nil {
+		conditions = append(conditions, fmt.Sprintf("(created_at, id) %s (%s, %s)", comparator, param(options.After.CreatedAt), param(options.After.Id)))
+	}
+	query := "SELECT id, post_content, user_id, created_at, version FROM posts WHERE " + strings.Join(conditions, " AND ")
+	query += fmt.Sprintf(" ORDER BY created_at %s, id %s LIMIT %s", direction, direction, param(options.Limit))
+	if options.After == nil {
+		query += " OFFSET " + param(options.Page*uint64(options.Limit))
+	}
+	rows, err := repo.reader(ctx).QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -164,7 +449,7 @@ func (repo *PostgresRepository) ListPost(ctx context.Context, page uint64) ([]*m
 	var posts []*models.Post
 	for rows.Next() {
 		var post = models.Post{}
-		if err = rows.Scan(&post.Id, &post.PostContent, &post.UserId, &post.CreateAt); err == nil {
+		if err = rows.Scan(&post.Id, &post.PostContent, &post.UserId, &post.CreateAt, &post.Version); err == nil {
 			posts = append(posts, &post)
 		}
 	}
@@ -174,22 +459,37 @@ func (repo *PostgresRepository) ListPost(ctx context.Context, page uint64) ([]*m
 	return posts, nil
 }
 
-func getPageSize() int {
-	if value, ok := configMap["page"]; ok {
-		return value
-	}
-	page := 2
-	err := godotenv.Load(".env")
+// SearchPosts: búsqueda full-text sobre post_content usando search_vector,
+// los resultados se ordenan por relevancia y luego por fecha de creación descendente
+func (repo *PostgresRepository) SearchPosts(ctx context.Context, options repository.SearchPostOptions) ([]*models.PostSearchResult, error) {
+	//ts_headline no escapa el contenido, se resalta con marcas que no son HTML y el snippet
+	//se arma con repository.HighlightSnippet
+	headline := fmt.Sprintf(`StartSel="%s", StopSel="%s"`, repository.HIGHLIGHT_MARK_START, repository.HIGHLIGHT_MARK_STOP)
+	rows, err := repo.conn.QueryContext(ctx, `SELECT id, post_content, user_id, created_at, version, ts_rank(search_vector, query) AS rank, ts_headline('simple', post_content, query, $2)
+		FROM posts, plainto_tsquery('simple', $1) query
+		WHERE search_vector @@ query AND deleted_at IS NULL
+		ORDER BY rank DESC, created_at DESC, id DESC
+		LIMIT $3 OFFSET $4`, options.Query, headline, options.Limit, options.Offset)
 	if err != nil {
-		log.Printf("Error loading .env file, value PAGE\n")
-		return page
+		return nil, err
 	}
-	PAGE := os.Getenv("PAGE")
-	page, err = strconv.Atoi(PAGE)
-	if err != nil {
-		log.Printf("Error with PAGE value %s, must be number\n", PAGE)
-		page = 2
+	defer func() {
+		err = rows.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	var results []*models.PostSearchResult
+	for rows.Next() {
+		var result = models.PostSearchResult{}
+		if err = rows.Scan(&result.Id, &result.PostContent, &result.UserId, &result.CreateAt, &result.Version, &result.Rank, &result.Snippet); err == nil {
+			result.Snippet = repository.HighlightSnippet(result.Snippet)
+			results = append(results, &result)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
 	}
-	configMap["page"] = page
-	return page
+	return results, nil
 }
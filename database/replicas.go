@@ -0,0 +1,34 @@
+package database
+
+import (
+	"database/sql"
+	"sync/atomic"
+)
+
+// replicaSet: réplicas de lectura elegidas con round-robin entre las que están sanas
+type replicaSet struct {
+	replicas []*node
+	next     uint64
+}
+
+// pick: retorna la siguiente réplica sana, o nil si no hay ninguna
+func (set *replicaSet) pick() *sql.DB {
+	if set == nil {
+		return nil
+	}
+	for range set.replicas {
+		i := atomic.AddUint64(&set.next, 1)
+		candidate := set.replicas[i%uint64(len(set.replicas))]
+		if candidate.isHealthy() {
+			return candidate.db
+		}
+	}
+	return nil
+}
+
+func (set *replicaSet) nodes() []*node {
+	if set == nil {
+		return nil
+	}
+	return set.replicas
+}
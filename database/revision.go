@@ -0,0 +1,60 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"w00k/go/rest-ws/models"
+	"w00k/go/rest-ws/repository"
+)
+
+// InsertPostRevision: guarda una revisión del post con el número siguiente a la última,
+// asigna el número de revisión y la fecha al objeto recibido
+func (repo *PostgresRepository) InsertPostRevision(ctx context.Context, revision *models.PostRevision) error {
+	return repo.writer(ctx).QueryRowContext(ctx, `INSERT INTO post_revisions (post_id, revision, post_content, editor_id)
+		SELECT $1, COALESCE(MAX(revision), 0) + 1, $2, $3 FROM post_revisions WHERE post_id = $1
+		RETURNING revision, created_at`, revision.PostId, revision.PostContent, revision.EditorId).Scan(&revision.Revision, &revision.CreatedAt)
+}
+
+// ListPostRevisions: obtiene las revisiones del post ordenadas de la más antigua a la más nueva
+func (repo *PostgresRepository) ListPostRevisions(ctx context.Context, postId string) ([]*models.PostRevision, error) {
+	rows, err := repo.conn.QueryContext(ctx, "SELECT post_id, revision, post_content, editor_id, created_at FROM post_revisions WHERE post_id = $1 ORDER BY revision", postId)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = rows.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	var revisions []*models.PostRevision
+	for rows.Next() {
+		var revision = models.PostRevision{}
+		if err = rows.Scan(&revision.PostId, &revision.Revision, &revision.PostContent, &revision.EditorId, &revision.CreatedAt); err == nil {
+			revisions = append(revisions, &revision)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// GetPostRevision: obtiene una revisión del post
+// los casos que soporta son:
+// - obtiene la revisión, la retorna
+// - en caso de no encontrar la revisión, retorna nil y repository.ErrNotFound
+// - en caso de error, retorna nil y el error
+func (repo *PostgresRepository) GetPostRevision(ctx context.Context, postId string, number int) (*models.PostRevision, error) {
+	var revision = models.PostRevision{}
+	err := repo.conn.QueryRowContext(ctx, "SELECT post_id, revision, post_content, editor_id, created_at FROM post_revisions WHERE post_id = $1 AND revision = $2", postId, number).Scan(&revision.PostId, &revision.Revision, &revision.PostContent, &revision.EditorId, &revision.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
@@ -0,0 +1,159 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"w00k/go/rest-ws/models"
+	"w00k/go/rest-ws/repository"
+)
+
+// InsertRefreshToken: guarda el refresh token y asigna su fecha de creación
+func (repo *PostgresRepository) InsertRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	return repo.writer(ctx).QueryRowContext(ctx, "INSERT INTO refresh_tokens (id, token_hash, user_id, family_id, expires_at) VALUES ($1, $2, $3, $4, $5) RETURNING created_at",
+		token.Id, token.TokenHash, token.UserId, token.FamilyId, token.ExpiresAt.UTC()).Scan(&token.CreatedAt)
+}
+
+// GetRefreshToken: obtiene el refresh token por su hash, se lee del primario porque
+// un token recién rotado puede no haber llegado a las réplicas
+// los casos que soporta son:
+// - obtiene el token, lo retorna
+// - en caso de no encontrar el token, retorna nil y repository.ErrNotFound
+// - en caso de error, retorna nil y el error
+func (repo *PostgresRepository) GetRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	var token = models.RefreshToken{}
+	var usedAt, revokedAt sql.NullTime
+	err := repo.conn.QueryRowContext(ctx, "SELECT id, token_hash, user_id, family_id, created_at, expires_at, used_at, revoked_at FROM refresh_tokens WHERE token_hash = $1", tokenHash).
+		Scan(&token.Id, &token.TokenHash, &token.UserId, &token.FamilyId, &token.CreatedAt, &token.ExpiresAt, &usedAt, &revokedAt)
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	return &token, nil
+}
+
+// UseRefreshToken: marca el refresh token como usado
+// los casos que soporta son:
+// - marca el token, retorna nil
+// - el token ya estaba usado o revocado, retorna repository.ErrTokenUsed
+// - error al actualizar el token, retorna el error
+func (repo *PostgresRepository) UseRefreshToken(ctx context.Context, id string) error {
+	result, err := repo.writer(ctx).ExecContext(ctx, "UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1 AND used_at IS NULL AND revoked_at IS NULL", id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return repository.ErrTokenUsed
+	}
+	return nil
+}
+
+// RevokeRefreshTokenFamily: revoca todos los refresh tokens de la familia
+func (repo *PostgresRepository) RevokeRefreshTokenFamily(ctx context.Context, familyId string) error {
+	_, err := repo.writer(ctx).ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL", familyId)
+	return err
+}
+
+// RevokeToken: guarda el jti del access token como revocado, si ya estaba revocado no hace nada
+func (repo *PostgresRepository) RevokeToken(ctx context.Context, jti string, userId string, expiresAt time.Time) error {
+	_, err := repo.writer(ctx).ExecContext(ctx, "INSERT INTO revoked_tokens (jti, user_id, expires_at) VALUES ($1, $2, $3) ON CONFLICT (jti) DO NOTHING", jti, userId, expiresAt.UTC())
+	return err
+}
+
+// RevokeUserTokens: los access tokens del usuario emitidos antes de before dejan de ser válidos,
+// la fecha se trunca a segundos porque iat se guarda en segundos, y se revocan sus refresh tokens
+// los casos que soporta son:
+// - revoca los tokens, retorna nil
+// - el usuario no existe, retorna repository.ErrNotFound
+// - error al revocar los tokens, retorna el error
+func (repo *PostgresRepository) RevokeUserTokens(ctx context.Context, userId string, before time.Time) error {
+	result, err := repo.writer(ctx).ExecContext(ctx, "UPDATE users SET tokens_valid_after = $2 WHERE id = $1", userId, before.UTC().Truncate(time.Second))
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return repository.ErrNotFound
+	}
+	_, err = repo.writer(ctx).ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL", userId)
+	return err
+}
+
+// IsTokenRevoked: se consulta en el primario para que un logout tenga efecto inmediato
+func (repo *PostgresRepository) IsTokenRevoked(ctx context.Context, jti string, userId string, issuedAt time.Time) (bool, error) {
+	var revoked bool
+	err := repo.conn.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE jti = $1)
+		OR EXISTS(SELECT 1 FROM users WHERE id = $2 AND tokens_valid_after > $3)`, jti, userId, issuedAt.UTC()).Scan(&revoked)
+	return revoked, err
+}
+
+// InsertPasswordResetToken: guarda el token para restablecer la contraseña y asigna su fecha de creación
+func (repo *PostgresRepository) InsertPasswordResetToken(ctx context.Context, token *models.PasswordResetToken) error {
+	return repo.writer(ctx).QueryRowContext(ctx, "INSERT INTO password_reset_tokens (id, token_hash, user_id, expires_at) VALUES ($1, $2, $3, $4) RETURNING created_at",
+		token.Id, token.TokenHash, token.UserId, token.ExpiresAt.UTC()).Scan(&token.CreatedAt)
+}
+
+// UsePasswordResetToken: marca como usado el token con ese hash y todos los demás tokens pendientes
+// del usuario, así ningún otro link enviado antes sigue sirviendo
+// los casos que soporta son:
+// - marca el token, lo retorna
+// - el token no existe, ya se usó o expiró, retorna nil y repository.ErrNotFound
+// - error al actualizar los tokens, retorna nil y el error
+func (repo *PostgresRepository) UsePasswordResetToken(ctx context.Context, tokenHash string) (*models.PasswordResetToken, error) {
+	var token = models.PasswordResetToken{}
+	var usedAt time.Time
+	err := repo.writer(ctx).QueryRowContext(ctx, `UPDATE password_reset_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING id, token_hash, user_id, created_at, expires_at, used_at`, tokenHash).
+		Scan(&token.Id, &token.TokenHash, &token.UserId, &token.CreatedAt, &token.ExpiresAt, &usedAt)
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	token.UsedAt = &usedAt
+	_, err = repo.writer(ctx).ExecContext(ctx, "UPDATE password_reset_tokens SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL", token.UserId)
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// PurgeExpiredTokens: elimina los refresh tokens, los tokens para restablecer la contraseña
+// y las revocaciones de access tokens que expiraron
+// antes de la fecha indicada, retorna la cantidad de registros eliminados
+func (repo *PostgresRepository) PurgeExpiredTokens(ctx context.Context, before time.Time) (int64, error) {
+	var purged int64
+	for _, query := range []string{
+		"DELETE FROM refresh_tokens WHERE expires_at < $1",
+		"DELETE FROM revoked_tokens WHERE expires_at < $1",
+		"DELETE FROM password_reset_tokens WHERE expires_at < $1",
+	} {
+		result, err := repo.writer(ctx).ExecContext(ctx, query, before.UTC())
+		if err != nil {
+			return purged, err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return purged, err
+		}
+		purged += affected
+	}
+	return purged, nil
+}
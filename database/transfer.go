@@ -0,0 +1,136 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+	"w00k/go/rest-ws/models"
+)
+
+// ScanUsers: obtiene hasta limit usuarios con id mayor que after ordenados por id,
+// incluye el hash de la contraseña para poder exportarlos
+func (repo *PostgresRepository) ScanUsers(ctx context.Context, after string, limit int) ([]*models.User, error) {
+	rows, err := repo.reader(ctx).QueryContext(ctx, "SELECT id, email, password, created_at, role, disabled_at, email_verified_at FROM users WHERE id > $1 ORDER BY id LIMIT $2", after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = rows.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	var users []*models.User
+	for rows.Next() {
+		var user = models.User{}
+		var disabledAt, emailVerifiedAt sql.NullTime
+		if err = rows.Scan(&user.Id, &user.Email, &user.Password, &user.CreatedAt, &user.Role, &disabledAt, &emailVerifiedAt); err != nil {
+			return nil, err
+		}
+		user.DisabledAt = nullTime(disabledAt)
+		user.EmailVerifiedAt = nullTime(emailVerifiedAt)
+		users = append(users, &user)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// ScanPosts: obtiene hasta limit posts con id mayor que after ordenados por id,
+// incluye los posts borrados que todavía no se eliminaron definitivamente
+func (repo *PostgresRepository) ScanPosts(ctx context.Context, after string, limit int) ([]*models.Post, error) {
+	rows, err := repo.reader(ctx).QueryContext(ctx, "SELECT id, post_content, user_id, created_at, deleted_at, moderated_at, version FROM posts WHERE id > $1 ORDER BY id LIMIT $2", after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = rows.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	var posts []*models.Post
+	for rows.Next() {
+		var post = models.Post{}
+		var deletedAt, moderatedAt sql.NullTime
+		if err = rows.Scan(&post.Id, &post.PostContent, &post.UserId, &post.CreateAt, &deletedAt, &moderatedAt, &post.Version); err != nil {
+			return nil, err
+		}
+		post.DeletedAt = nullTime(deletedAt)
+		post.ModeratedAt = nullTime(moderatedAt)
+		posts = append(posts, &post)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// UpsertUser: inserta el usuario con su id, contraseña, fecha de creación, rol, estado y verificación
+// del correo, si ya existe un usuario con ese id lo reemplaza; el correo se normaliza como en el registro
+func (repo *PostgresRepository) UpsertUser(ctx context.Context, user *models.User) error {
+	_, err := repo.writer(ctx).ExecContext(ctx, `INSERT INTO users (id, email, password, created_at, role, disabled_at, email_verified_at) VALUES ($1, lower(trim($2)), $3, $4, COALESCE(NULLIF($5, ''), 'user'), $6, $7)
+		ON CONFLICT (id) DO UPDATE SET email = EXCLUDED.email, password = EXCLUDED.password, created_at = EXCLUDED.created_at,
+		role = EXCLUDED.role, disabled_at = EXCLUDED.disabled_at, email_verified_at = EXCLUDED.email_verified_at`,
+		user.Id, user.Email, user.Password, user.CreatedAt.UTC(), user.Role, utcNullTime(user.DisabledAt), utcNullTime(user.EmailVerifiedAt))
+	return err
+}
+
+// utcNullTime: convierte una fecha opcional en un parámetro que puede ser NULL
+func utcNullTime(value *time.Time) sql.NullTime {
+	if value == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: value.UTC(), Valid: true}
+}
+
+// UpsertPost: inserta el post con su id, fechas, moderación y versión,
+// si ya existe un post con ese id lo reemplaza
+func (repo *PostgresRepository) UpsertPost(ctx context.Context, post *models.Post) error {
+	_, err := repo.writer(ctx).ExecContext(ctx, `INSERT INTO posts (id, post_content, user_id, created_at, deleted_at, moderated_at, version) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (id) DO UPDATE SET post_content = EXCLUDED.post_content, user_id = EXCLUDED.user_id,
+		created_at = EXCLUDED.created_at, deleted_at = EXCLUDED.deleted_at, moderated_at = EXCLUDED.moderated_at, version = EXCLUDED.version`,
+		post.Id, post.PostContent, post.UserId, post.CreateAt.UTC(), utcNullTime(post.DeletedAt), utcNullTime(post.ModeratedAt), post.Version)
+	return err
+}
+
+// ScanPostRevisions: obtiene hasta limit revisiones ordenadas por post y número, empezando
+// después de la revisión afterRevision del post afterPostId
+func (repo *PostgresRepository) ScanPostRevisions(ctx context.Context, afterPostId string, afterRevision int, limit int) ([]*models.PostRevision, error) {
+	rows, err := repo.reader(ctx).QueryContext(ctx, "SELECT post_id, revision, post_content, editor_id, created_at FROM post_revisions WHERE (post_id, revision) > ($1, $2) ORDER BY post_id, revision LIMIT $3", afterPostId, afterRevision, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = rows.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	var revisions []*models.PostRevision
+	for rows.Next() {
+		var revision = models.PostRevision{}
+		if err = rows.Scan(&revision.PostId, &revision.Revision, &revision.PostContent, &revision.EditorId, &revision.CreatedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, &revision)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// UpsertPostRevision: inserta la revisión con su número y fecha,
+// si ya existe esa revisión del post la reemplaza
+func (repo *PostgresRepository) UpsertPostRevision(ctx context.Context, revision *models.PostRevision) error {
+	_, err := repo.writer(ctx).ExecContext(ctx, `INSERT INTO post_revisions (post_id, revision, post_content, editor_id, created_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (post_id, revision) DO UPDATE SET post_content = EXCLUDED.post_content, editor_id = EXCLUDED.editor_id, created_at = EXCLUDED.created_at`,
+		revision.PostId, revision.Revision, revision.PostContent, revision.EditorId, revision.CreatedAt.UTC())
+	return err
+}
@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"w00k/go/rest-ws/repository"
+)
+
+// WithTx: ejecuta fn dentro de una transacción, el repositorio que recibe fn usa la transacción
+// los casos que soporta son:
+// - fn retorna nil, se hace commit
+// - fn retorna un error o hace panic, se hace rollback y se retorna el error (o se propaga el panic)
+// - si el repositorio ya está en una transacción, se usa un savepoint, así un error en la
+// llamada anidada solo deshace sus propios cambios y la transacción externa decide si continúa
+// - si el contexto tiene repository.WithSnapshot, la transacción es REPEATABLE READ de solo lectura
+func (repo *PostgresRepository) WithTx(ctx context.Context, fn func(tx repository.Repository) error) (err error) {
+	if repo.tx != nil {
+		return repo.withSavepoint(ctx, fn)
+	}
+	var options *sql.TxOptions
+	if repository.ReadsSnapshot(ctx) {
+		options = &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+	}
+	tx, err := repo.db.BeginTx(ctx, options)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+	if err = fn(&PostgresRepository{db: repo.db, conn: tx, tx: tx, primary: repo.primary, readYourWrites: repo.readYourWrites}); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			log.Println(rollbackErr)
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// withSavepoint: transacción anidada dentro de la transacción en curso
+func (repo *PostgresRepository) withSavepoint(ctx context.Context, fn func(tx repository.Repository) error) (err error) {
+	nested := &PostgresRepository{db: repo.db, conn: repo.tx, tx: repo.tx, depth: repo.depth + 1, primary: repo.primary, readYourWrites: repo.readYourWrites}
+	savepoint := fmt.Sprintf("sp_%d", nested.depth)
+	if _, err = repo.tx.ExecContext(ctx, "SAVEPOINT "+savepoint); err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			repo.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+savepoint)
+			panic(p)
+		}
+	}()
+	if err = fn(nested); err != nil {
+		if _, rollbackErr := repo.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+savepoint); rollbackErr != nil {
+			log.Println(rollbackErr)
+		}
+		return err
+	}
+	_, err = repo.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+savepoint)
+	return err
+}
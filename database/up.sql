@@ -4,9 +4,19 @@ CREATE TABLE users (
     id VARCHAR(32) PRIMARY KEY,
     password VARCHAR(255) NOT NULL,
     email VARCHAR(255) UNIQUE NOT NULL,
-    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    role VARCHAR(32) NOT NULL DEFAULT 'user',
+    disabled_at TIMESTAMP,
+    -- NULL mientras el usuario no abra el link de verificación que se envía al registrarse
+    email_verified_at TIMESTAMP,
+    -- los tokens emitidos antes de esta fecha no son válidos (cambio de contraseña, cerrar todas las sesiones)
+    tokens_valid_after TIMESTAMP
 );
 
+-- los correos se guardan normalizados, el índice permite buscarlos sin importar mayúsculas
+-- (usuarios registrados o importados antes de la normalización) y evita duplicados
+CREATE UNIQUE INDEX users_email_lower_idx ON users (lower(email));
+
 DROP TABLE IF EXISTS posts;
 
 CREATE TABLE posts (
@@ -14,5 +24,110 @@ CREATE TABLE posts (
     post_content VARCHAR(32) NOT NULL,
     created_at TIMESTAMP NOT NULL DEFAULT NOW(),
     user_id VARCHAR(32) NOT NULL,
+    search_vector TSVECTOR,
+    deleted_at TIMESTAMP,
+    -- borrado por un moderador, el dueño no puede restaurarlo
+    moderated_at TIMESTAMP,
+    version INT NOT NULL DEFAULT 1,
     FOREIGN KEY (user_id) REFERENCES users(id)
-)
\ No newline at end of file
+);
+
+CREATE INDEX posts_created_at_id_idx ON posts (created_at, id);
+CREATE INDEX posts_user_id_created_at_id_idx ON posts (user_id, created_at, id);
+CREATE INDEX posts_deleted_at_idx ON posts (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- búsqueda full-text: el trigger mantiene search_vector sincronizado con post_content
+CREATE INDEX posts_search_vector_idx ON posts USING GIN (search_vector);
+
+CREATE TRIGGER posts_search_vector_update BEFORE INSERT OR UPDATE ON posts
+    FOR EACH ROW EXECUTE PROCEDURE tsvector_update_trigger(search_vector, 'pg_catalog.simple', post_content);
+
+DROP TABLE IF EXISTS post_revisions;
+
+-- historial de contenidos de cada post, la revisión 1 es el contenido con el que se creó
+CREATE TABLE post_revisions (
+    post_id VARCHAR(32) NOT NULL,
+    revision INT NOT NULL,
+    post_content VARCHAR(32) NOT NULL,
+    editor_id VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (post_id, revision),
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (editor_id) REFERENCES users(id)
+);
+
+DROP TABLE IF EXISTS outbox;
+
+-- eventos pendientes de publicar, se escriben en la misma transacción que los cambios de los posts
+CREATE TABLE outbox (
+    id BIGSERIAL PRIMARY KEY,
+    event_type VARCHAR(64) NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    delivered_at TIMESTAMP,
+    -- el relay que tomó el evento lo publica hasta esta fecha, después otro relay puede tomarlo
+    claimed_until TIMESTAMP
+);
+
+CREATE INDEX outbox_pending_idx ON outbox (id) WHERE delivered_at IS NULL;
+CREATE INDEX outbox_delivered_at_idx ON outbox (delivered_at);
+
+DROP TABLE IF EXISTS refresh_tokens;
+
+-- refresh tokens rotativos, solo se guarda el hash sha256 del token; family_id agrupa
+-- los tokens obtenidos a partir del mismo login para revocarlos juntos si uno se reutiliza
+CREATE TABLE refresh_tokens (
+    id VARCHAR(32) PRIMARY KEY,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    user_id VARCHAR(32) NOT NULL,
+    family_id VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+CREATE INDEX refresh_tokens_expires_at_idx ON refresh_tokens (expires_at);
+
+DROP TABLE IF EXISTS revoked_tokens;
+
+-- access tokens revocados con logout, se guardan hasta que expiran
+CREATE TABLE revoked_tokens (
+    jti VARCHAR(32) PRIMARY KEY,
+    user_id VARCHAR(32) NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX revoked_tokens_expires_at_idx ON revoked_tokens (expires_at);
+
+DROP TABLE IF EXISTS password_reset_tokens;
+
+-- tokens de los links para restablecer la contraseña, solo se guarda el hash sha256 del token
+-- y se marcan como usados al restablecerla para que sirvan una sola vez
+CREATE TABLE password_reset_tokens (
+    id VARCHAR(32) PRIMARY KEY,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    user_id VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX password_reset_tokens_user_id_idx ON password_reset_tokens (user_id);
+CREATE INDEX password_reset_tokens_expires_at_idx ON password_reset_tokens (expires_at);
+
+DROP TABLE IF EXISTS login_attempts;
+
+-- intentos fallidos de login por cuenta ("account:<email>") y por ip ("ip:<ip>"),
+-- la cuenta no necesita existir para no revelar qué correos están registrados
+CREATE TABLE login_attempts (
+    key VARCHAR(320) PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    last_failure_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP
+);
+
+CREATE INDEX login_attempts_last_failure_at_idx ON login_attempts (last_failure_at);
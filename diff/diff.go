@@ -0,0 +1,68 @@
+package diff
+
+import "strings"
+
+// operaciones de un cambio entre dos textos
+const (
+	EQUAL  = "equal"
+	INSERT = "insert"
+	DELETE = "delete"
+)
+
+// Change: fragmento del texto que se mantiene, se agrega o se borra
+type Change struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// Words: calcula los cambios palabra a palabra para pasar del texto from al texto to,
+// usando la subsecuencia común más larga entre las palabras de ambos textos
+func Words(from string, to string) []Change {
+	a, b := strings.Fields(from), strings.Fields(to)
+	//lcs[i][j]: largo de la subsecuencia común más larga entre a[i:] y b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	changes := make([]Change, 0)
+	add := func(op string, word string) {
+		if n := len(changes); n > 0 && changes[n-1].Op == op {
+			changes[n-1].Text += " " + word
+			return
+		}
+		changes = append(changes, Change{Op: op, Text: word})
+	}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			add(EQUAL, a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			add(DELETE, a[i])
+			i++
+		default:
+			add(INSERT, b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		add(DELETE, a[i])
+	}
+	for ; j < len(b); j++ {
+		add(INSERT, b[j])
+	}
+	return changes
+}
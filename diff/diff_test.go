@@ -0,0 +1,30 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWords(t *testing.T) {
+	tests := []struct {
+		name string
+		from string
+		to   string
+		want []Change
+	}{
+		{"both empty", "", "", []Change{}},
+		{"same text", "hola mundo", "hola  mundo", []Change{{EQUAL, "hola mundo"}}},
+		{"from empty", "", "hola mundo", []Change{{INSERT, "hola mundo"}}},
+		{"to empty", "hola mundo", "", []Change{{DELETE, "hola mundo"}}},
+		{"word replaced", "el gato negro", "el perro negro", []Change{{EQUAL, "el"}, {DELETE, "gato"}, {INSERT, "perro"}, {EQUAL, "negro"}}},
+		{"word added at end", "uno dos", "uno dos tres", []Change{{EQUAL, "uno dos"}, {INSERT, "tres"}}},
+		{"word removed in middle", "uno dos tres", "uno tres", []Change{{EQUAL, "uno"}, {DELETE, "dos"}, {EQUAL, "tres"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Words(test.from, test.to); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Words(%q, %q) = %v, want %v", test.from, test.to, got, test.want)
+			}
+		})
+	}
+}
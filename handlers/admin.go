@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+	"w00k/go/rest-ws/auth"
+	"w00k/go/rest-ws/models"
+	"w00k/go/rest-ws/outbox"
+	"w00k/go/rest-ws/repository"
+	"w00k/go/rest-ws/server"
+
+	"github.com/gorilla/mux"
+)
+
+type ListUsersResponse struct {
+	Users      []*models.User `json:"users"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// ListUsersHandler: endpoint de administración para listar los usuarios ordenados por id,
+// para la página siguiente se envía next_cursor en el parámetro cursor
+// los casos son:
+// - si limit es inválido, se retorna un response de error con HTTP 400
+// - si hay algún error con el repositorio, se retorna un response de error con HTTP 500
+// - si es caso exitoso, se responde con un ListUsersResponse con HTTP 200
+func ListUsersHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, err := pageLimit(s.Config(), r.URL.Query().Get("limit"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		users, err := s.Repository().ScanUsers(r.Context(), r.URL.Query().Get("cursor"), limit+1)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		response := ListUsersResponse{Users: users}
+		if len(users) > limit {
+			response.Users = users[:limit]
+			response.NextCursor = users[limit-1].Id
+		}
+		if response.Users == nil {
+			response.Users = []*models.User{}
+		}
+		for _, user := range response.Users {
+			user.Password = ""
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// DisableUserHandler: endpoint de administración para deshabilitar un usuario, el usuario
+// no puede volver a loguearse y se revocan todos sus tokens
+// los casos son:
+// - si el administrador intenta deshabilitarse a sí mismo, se retorna un response de error con HTTP 409
+// - si el usuario no existe, se retorna un response de error con HTTP 404
+// - si hay algún error con el repositorio, se retorna un response de error con HTTP 500
+// - si es caso exitoso, se responde con un MessageResponse con HTTP 200
+func DisableUserHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		if id == auth.UserIdFrom(r.Context()) {
+			http.Error(w, "Cannot disable yourself", http.StatusConflict)
+			return
+		}
+		err := s.Repository().WithTx(r.Context(), func(tx repository.Repository) error {
+			if err := tx.SetUserDisabled(r.Context(), id, true); err != nil {
+				return err
+			}
+			return tx.RevokeUserTokens(r.Context(), id, time.Now())
+		})
+		if err != nil {
+			http.Error(w, err.Error(), repositoryErrorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(MessageResponse{
+			Message: "User disabled",
+		})
+	}
+}
+
+// EnableUserHandler: endpoint de administración para volver a habilitar un usuario
+// los casos son:
+// - si el usuario no existe, se retorna un response de error con HTTP 404
+// - si hay algún error con el repositorio, se retorna un response de error con HTTP 500
+// - si es caso exitoso, se responde con un MessageResponse con HTTP 200
+func EnableUserHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := s.Repository().SetUserDisabled(r.Context(), mux.Vars(r)["id"], false); err != nil {
+			http.Error(w, err.Error(), repositoryErrorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(MessageResponse{
+			Message: "User enabled",
+		})
+	}
+}
+
+// ModeratePostHandler: endpoint de administración para borrar el post de cualquier usuario,
+// el borrado es lógico pero el dueño no puede restaurarlo, incluso si ya lo había borrado él
+// los casos son:
+// - si el post no existe o ya fue moderado, se retorna un response de error con HTTP 404
+// - si hay algún error con el repositorio, se retorna un response de error con HTTP 500
+// - si es caso exitoso, se responde con un PostUpdateResponse con HTTP 200
+func ModeratePostHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		err := s.Repository().WithTx(r.Context(), func(tx repository.Repository) error {
+			if err := tx.ForceDeletePost(r.Context(), id); err != nil {
+				return err
+			}
+			return outbox.Enqueue(r.Context(), tx, models.POST_DELETED, map[string]string{"id": id})
+		})
+		if err != nil {
+			http.Error(w, err.Error(), repositoryErrorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(PostUpdateResponse{
+			Menssage: "Post deleted",
+		})
+	}
+}
+
+// MetricsHandler: endpoint de administración con las métricas del servidor y las globales del proceso en formato JSON
+func MetricsHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.Metrics().ServeHTTP(w, r)
+	}
+}
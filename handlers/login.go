@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"w00k/go/rest-ws/audit"
+	"w00k/go/rest-ws/repository"
+	"w00k/go/rest-ws/server"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	dummyHash     []byte
+	dummyHashOnce sync.Once
+)
+
+// compareDummyPassword: compara la contraseña con un hash cualquiera del mismo costo, cuando el correo
+// no existe el login tarda lo mismo que con una contraseña incorrecta y no revela qué correos existen
+func compareDummyPassword(password string) {
+	dummyHashOnce.Do(func() {
+		hash, err := bcrypt.GenerateFromPassword([]byte("dummy password"), HASH_COST)
+		if err != nil {
+			log.Println("dummy password hash: ", err)
+		}
+		dummyHash = hash
+	})
+	bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+}
+
+// loginKeys: keys con las que se cuentan los intentos fallidos, la de la cuenta y la de la ip
+func loginKeys(s server.Server, r *http.Request, email string) (string, string) {
+	hops := 0
+	if s.Config().TrustProxyHeaders {
+		hops = s.Config().TrustedProxyHops
+	}
+	return "account:" + email, "ip:" + clientIp(r, hops)
+}
+
+// clientIp: ip del cliente, con trustedHops > 0 se usa la ip que agregó a X-Forwarded-For el primero de los
+// trustedHops proxies de confianza (contando desde la derecha), las ips de más a la izquierda las envía el
+// cliente y no se usan; si el header tiene menos ips que proxies se usa la ip de la conexión
+func clientIp(r *http.Request, trustedHops int) string {
+	if trustedHops > 0 {
+		var forwarded []string
+		for _, value := range r.Header.Values("X-Forwarded-For") {
+			forwarded = append(forwarded, strings.Split(value, ",")...)
+		}
+		if len(forwarded) >= trustedHops {
+			if ip := strings.TrimSpace(forwarded[len(forwarded)-trustedHops]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// loginLimits: límites de intentos de la cuenta y de la ip
+func loginLimits(s server.Server) (repository.LoginLimit, repository.LoginLimit) {
+	config := s.Config()
+	account := repository.LoginLimit{MaxAttempts: config.LoginMaxAttempts, Backoff: config.LoginBackoff, Lockout: config.LoginLockout}
+	ip := account
+	ip.MaxAttempts = config.LoginIpMaxAttempts
+	return account, ip
+}
+
+// releaseLoginAttempt: descuenta un intento reservado que no falló
+func releaseLoginAttempt(ctx context.Context, s server.Server, key string) {
+	if err := s.Repository().ReleaseLoginAttempt(ctx, key); err != nil {
+		log.Println("login attempts: ", err)
+	}
+}
+
+// reserveLoginAttempt: reserva el intento antes de validar la contraseña, si la key está bloqueada
+// retorna el tiempo que falta para que termine el bloqueo, si este intento la bloqueó lo registra en la auditoría
+func reserveLoginAttempt(ctx context.Context, s server.Server, key string, limit repository.LoginLimit) (time.Duration, error) {
+	attempt, err := s.Repository().ReserveLoginAttempt(ctx, key, limit)
+	if errors.Is(err, repository.ErrLoginLocked) {
+		locked := time.Second
+		if attempt.LockedUntil != nil && time.Until(*attempt.LockedUntil) > locked {
+			locked = time.Until(*attempt.LockedUntil)
+		}
+		return locked, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if attempt.LockedUntil != nil {
+		audit.Record(ctx, audit.LOGIN_LOCKOUT, map[string]string{
+			"key":      key,
+			"failures": strconv.Itoa(attempt.Failures),
+			"duration": time.Until(*attempt.LockedUntil).Round(time.Second).String(),
+		})
+	}
+	return 0, nil
+}
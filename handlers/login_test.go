@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIp(t *testing.T) {
+	tests := []struct {
+		name        string
+		forwarded   []string
+		trustedHops int
+		want        string
+	}{
+		{"proxy headers not trusted", []string{"203.0.113.7"}, 0, "192.0.2.1"},
+		{"without header", nil, 1, "192.0.2.1"},
+		{"one proxy", []string{"203.0.113.7"}, 1, "203.0.113.7"},
+		{"spoofed entry before the proxy", []string{"10.0.0.1, 203.0.113.7"}, 1, "203.0.113.7"},
+		{"spoofed entries in several headers", []string{"10.0.0.1", "10.0.0.2, 203.0.113.7"}, 1, "203.0.113.7"},
+		{"two proxies", []string{"10.0.0.1, 203.0.113.7, 198.51.100.2"}, 2, "203.0.113.7"},
+		{"fewer entries than proxies", []string{"203.0.113.7"}, 2, "192.0.2.1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/login", nil)
+			r.RemoteAddr = "192.0.2.1:4321"
+			for _, value := range test.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if got := clientIp(r, test.trustedHops); got != test.want {
+				t.Errorf("clientIp() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
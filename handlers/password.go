@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+	"w00k/go/rest-ws/auth"
+	"w00k/go/rest-ws/mailer"
+	"w00k/go/rest-ws/models"
+	"w00k/go/rest-ws/repository"
+	"w00k/go/rest-ws/server"
+
+	"github.com/segmentio/ksuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MAIL_TIMEOUT: tiempo máximo para el trabajo que se hace fuera del request, como enviar un correo
+const MAIL_TIMEOUT = 30 * time.Second
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// ForgotPasswordHandler: endpoint para pedir un link para restablecer la contraseña, se responde
+// lo mismo exista o no el correo para no revelar qué correos están registrados, y la búsqueda del
+// usuario, el token y el correo se hacen después de responder para que el tiempo de respuesta tampoco lo revele
+// los casos son:
+// - si el request es inválido, se retorna un response de error con HTTP 400
+// - en cualquier otro caso, se responde con un MessageResponse con HTTP 202
+func ForgotPasswordHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request = ForgotPasswordRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		email := auth.NormalizeEmail(request.Email)
+		go func() {
+			//el request ya terminó, se usa un contexto propio
+			ctx, cancel := context.WithTimeout(context.Background(), MAIL_TIMEOUT)
+			defer cancel()
+			if err := createPasswordReset(ctx, s, email); err != nil {
+				log.Println("password reset: ", err)
+			}
+		}()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(MessageResponse{
+			Message: "If the email is registered, a reset link has been sent",
+		})
+	}
+}
+
+// createPasswordReset: si existe un usuario habilitado con el correo, guarda un token
+// y le envía el link
+func createPasswordReset(ctx context.Context, s server.Server, email string) error {
+	user, err := s.Repository().GetUserByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	if user.Id == "" || user.DisabledAt != nil {
+		return nil
+	}
+	id, err := ksuid.NewRandom()
+	if err != nil {
+		return err
+	}
+	token, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+	err = s.Repository().InsertPasswordResetToken(ctx, &models.PasswordResetToken{
+		Id:        id.String(),
+		TokenHash: hashToken(token),
+		UserId:    user.Id,
+		ExpiresAt: time.Now().Add(s.Config().PasswordResetTTL),
+	})
+	if err != nil {
+		return err
+	}
+	link, err := resetLink(s.Config().PasswordResetUrl, token)
+	if err != nil {
+		return err
+	}
+	return s.Mailer().Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body:    fmt.Sprintf("Use this link to choose a new password:\n\n%s\n\nThe link expires in %s and can be used once. If you did not ask for it, ignore this email.\n", link, s.Config().PasswordResetTTL),
+	})
+}
+
+// resetLink: agrega el token a la url del formulario, que puede tener otros parámetros
+func resetLink(formUrl string, token string) (string, error) {
+	link, err := url.Parse(formUrl)
+	if err != nil {
+		return "", err
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	return link.String(), nil
+}
+
+// resetForm: formulario por defecto del link para restablecer la contraseña, envía el token
+// y la nueva contraseña a POST /password/reset
+var resetForm = template.Must(template.New("reset").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Reset your password</title></head>
+<body>
+<form id="reset">
+<input type="hidden" name="token" value="{{.}}">
+<label>New password <input type="password" name="new_password" autocomplete="new-password" required></label>
+<button type="submit">Reset password</button>
+</form>
+<p id="result"></p>
+<script>
+document.getElementById("reset").addEventListener("submit", async function (event) {
+	event.preventDefault();
+	const response = await fetch(window.location.pathname, {
+		method: "POST",
+		headers: {"Content-Type": "application/json"},
+		body: JSON.stringify({token: this.token.value, new_password: this.new_password.value})
+	});
+	document.getElementById("result").textContent = response.ok ? "Password reset" : await response.text();
+});
+</script>
+</body>
+</html>
+`))
+
+// ResetPasswordFormHandler: formulario por defecto al que lleva el link del correo si no se configura
+// PasswordResetUrl, el token va en el parámetro token
+// los casos son:
+// - si el token no existe, se retorna un response de error con HTTP 400
+// - si es caso exitoso, se responde con el formulario en HTML con HTTP 200
+func ResetPasswordFormHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			http.Error(w, "token is required", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		resetForm.Execute(w, token)
+	}
+}
+
+// ResetPasswordHandler: endpoint para restablecer la contraseña con el token del link enviado por correo,
+// el token sirve una sola vez y se cierran todas las sesiones del usuario
+// los casos son:
+// - si el request es inválido, se retorna un response de error con HTTP 400
+// - si la contraseña nueva no cumple la policy, se retorna un ValidationErrorResponse con HTTP 400
+// - si el token no existe, ya se usó o expiró, se retorna un response de error con HTTP 400
+// - si hay algún error con el repositorio, se retorna un response de error con HTTP 500
+// - si es caso exitoso, se responde con un MessageResponse con HTTP 200
+func ResetPasswordHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request = ResetPasswordRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if request.Token == "" {
+			http.Error(w, "token is required", http.StatusBadRequest)
+			return
+		}
+		var errs validationErrors
+		errs.add("new_password", s.PasswordPolicy().Validate(request.NewPassword))
+		if errs.write(w) {
+			return
+		}
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(request.NewPassword), HASH_COST)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		err = s.Repository().WithTx(r.Context(), func(tx repository.Repository) error {
+			token, err := tx.UsePasswordResetToken(r.Context(), hashToken(request.Token))
+			if err != nil {
+				return err
+			}
+			if err := tx.UpdateUserPassword(r.Context(), token.UserId, string(hashedPassword)); err != nil {
+				return err
+			}
+			return tx.RevokeUserTokens(r.Context(), token.UserId, time.Now())
+		})
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(MessageResponse{
+			Message: "Password reset",
+		})
+	}
+}
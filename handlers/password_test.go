@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+	"w00k/go/rest-ws/mailer"
+	"w00k/go/rest-ws/models"
+	"w00k/go/rest-ws/server"
+)
+
+func TestForgotPasswordHandler(t *testing.T) {
+	repo := &stubRepository{
+		users: []*models.User{{Id: "user", Email: "user@mail.com"}},
+		block: make(chan struct{}),
+	}
+	s, m := newTestServer(t, &server.Config{}, repo)
+	r := httptest.NewRequest(http.MethodPost, "/password/forgot", strings.NewReader(`{"email":"user@mail.com"}`))
+	w := httptest.NewRecorder()
+	//GetUserByEmail queda bloqueado hasta cerrar block, el handler tiene que responder antes
+	responded := make(chan struct{})
+	go func() {
+		ForgotPasswordHandler(s)(w, r)
+		close(responded)
+	}()
+	select {
+	case <-responded:
+	case <-time.After(time.Second):
+		close(repo.block)
+		t.Fatal("handler waited for the user lookup before responding")
+	}
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusAccepted)
+	}
+	close(repo.block)
+	select {
+	case message := <-m:
+		if message.To != "user@mail.com" {
+			t.Errorf("email sent to %q, want %q", message.To, "user@mail.com")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reset email not sent")
+	}
+}
+
+func TestCreatePasswordReset(t *testing.T) {
+	disabledAt := time.Now()
+	users := []*models.User{
+		{Id: "user", Email: "user@mail.com"},
+		{Id: "disabled", Email: "disabled@mail.com", DisabledAt: &disabledAt},
+	}
+	tests := []struct {
+		name   string
+		email  string
+		sendTo string
+	}{
+		{"registered email", "user@mail.com", "user@mail.com"},
+		{"unknown email", "unknown@mail.com", ""},
+		{"disabled user", "disabled@mail.com", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo := &stubRepository{users: users}
+			s, m := newTestServer(t, &server.Config{PasswordResetUrl: "https://app.example.com/reset?lang=es"}, repo)
+			if err := createPasswordReset(context.Background(), s, test.email); err != nil {
+				t.Fatalf("createPasswordReset() error = %v", err)
+			}
+
+			if test.sendTo == "" {
+				if len(repo.resetTokens) != 0 {
+					t.Errorf("saved %d reset tokens, want none", len(repo.resetTokens))
+				}
+				if len(m) != 0 {
+					t.Errorf("sent %d emails, want none", len(m))
+				}
+				return
+			}
+			var message mailer.Message
+			select {
+			case message = <-m:
+			default:
+				t.Fatal("reset email not sent")
+			}
+			if message.To != test.sendTo {
+				t.Errorf("email sent to %q, want %q", message.To, test.sendTo)
+			}
+			link, err := url.Parse(regexp.MustCompile(`https://\S+`).FindString(message.Body))
+			if err != nil {
+				t.Fatalf("reset link: %v", err)
+			}
+			if link.Host != "app.example.com" || link.Path != "/reset" || link.Query().Get("lang") != "es" {
+				t.Errorf("reset link = %s, want the configured PasswordResetUrl", link)
+			}
+			if len(repo.resetTokens) != 1 || repo.resetTokens[0].TokenHash != hashToken(link.Query().Get("token")) {
+				t.Errorf("saved reset tokens do not match the token in the link %s", link)
+			}
+		})
+	}
+}
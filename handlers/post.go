@@ -1,15 +1,21 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
+	"w00k/go/rest-ws/auth"
 	"w00k/go/rest-ws/models"
+	"w00k/go/rest-ws/outbox"
 	"w00k/go/rest-ws/repository"
 	"w00k/go/rest-ws/server"
 
-	"github.com/golang-jwt/jwt"
 	"github.com/gorilla/mux"
 	"github.com/segmentio/ksuid"
 )
@@ -23,67 +29,77 @@ type PostResponse struct {
 	PostContent string `json:"post_content"`
 }
 
+type ListPostResponse struct {
+	Posts      []*models.Post `json:"posts"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+type SearchPostResponse struct {
+	Results  []*models.PostSearchResult `json:"results"`
+	NextPage *uint64                    `json:"next_page,omitempty"`
+}
+
 type PostUpdateResponse struct {
 	Menssage string `json:"message"`
 }
 
 func InsertPostHandler(s server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		tokenString := strings.TrimSpace(r.Header.Get("Authorization"))
-		token, err := jwt.ParseWithClaims(tokenString, &models.AppClaims{}, func(token *jwt.Token) (interface{}, error) {
-			return []byte(s.Config().JWTSecret), nil
-		})
+		claims, ok := auth.ClaimsFrom(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var postRequest = UpsertPostRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&postRequest); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		id, err := ksuid.NewRandom()
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		if claims, ok := token.Claims.(*models.AppClaims); ok && token.Valid {
-			var postRequest = UpsertPostRequest{}
-			if err := json.NewDecoder(r.Body).Decode(&postRequest); err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-			id, err := ksuid.NewRandom()
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-			post := models.Post{
-				Id:          id.String(),
-				PostContent: postRequest.PostContent,
-				UserId:      claims.UserId,
-			}
-			err = repository.InsertPost(r.Context(), &post)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-			var postMessage = models.WebsocketMessage{
-				Type:    "Post_Created",
-				Payload: post,
+		post := models.Post{
+			Id:          id.String(),
+			PostContent: postRequest.PostContent,
+			UserId:      claims.UserId,
+		}
+		err = s.Repository().WithTx(r.Context(), func(tx repository.Repository) error {
+			if err := tx.InsertPost(r.Context(), &post); err != nil {
+				return err
 			}
-			s.Hub().Broadcast(postMessage, nil)
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(PostResponse{
-				Id:          post.Id,
+			if err := tx.InsertPostRevision(r.Context(), &models.PostRevision{
+				PostId:      post.Id,
 				PostContent: post.PostContent,
-			})
-		} else {
+				EditorId:    post.UserId,
+			}); err != nil {
+				return err
+			}
+			return outbox.Enqueue(r.Context(), tx, models.POST_CREATED, post)
+		})
+		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(PostResponse{
+			Id:          post.Id,
+			PostContent: post.PostContent,
+		})
 	}
 }
 
 func GetPostByIdHandler(s server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		params := mux.Vars(r)
-		post, err := repository.GetPostById(r.Context(), params["id"])
+		post, err := s.Repository().GetPostById(r.Context(), params["id"])
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), repositoryErrorStatus(err))
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", postETag(post.Version))
 		json.NewEncoder(w).Encode(post)
 	}
 }
@@ -91,87 +107,344 @@ func GetPostByIdHandler(s server.Server) http.HandlerFunc {
 func UpdatePostHandler(s server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		params := mux.Vars(r)
-		tokenString := strings.TrimSpace(r.Header.Get("Authorization"))
-		token, err := jwt.ParseWithClaims(tokenString, &models.AppClaims{}, func(token *jwt.Token) (interface{}, error) {
-			return []byte(s.Config().JWTSecret), nil
+		claims, ok := auth.ClaimsFrom(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		version, ok := ifMatchVersion(w, r)
+		if !ok {
+			return
+		}
+		var postRequest = UpsertPostRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&postRequest); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		post := models.Post{
+			Id:          params["id"],
+			PostContent: postRequest.PostContent,
+			UserId:      claims.UserId,
+			Version:     version,
+		}
+		err := s.Repository().WithTx(r.Context(), func(tx repository.Repository) error {
+			return updatePost(r.Context(), tx, &post)
 		})
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
+			http.Error(w, err.Error(), repositoryErrorStatus(err))
 			return
 		}
-		if claims, ok := token.Claims.(*models.AppClaims); ok && token.Valid {
-			var postRequest = UpsertPostRequest{}
-			if err := json.NewDecoder(r.Body).Decode(&postRequest); err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", postETag(post.Version))
+		json.NewEncoder(w).Encode(PostUpdateResponse{
+			Menssage: "Post updated",
+		})
+	}
+}
+
+// updatePost: actualiza el contenido del post, guarda la nueva revisión y el evento
+// para los websockets, debe llamarse con el repositorio de una transacción
+func updatePost(ctx context.Context, tx repository.Repository, post *models.Post) error {
+	if err := tx.UpdatePost(ctx, post); err != nil {
+		return err
+	}
+	if err := tx.InsertPostRevision(ctx, &models.PostRevision{
+		PostId:      post.Id,
+		PostContent: post.PostContent,
+		EditorId:    post.UserId,
+	}); err != nil {
+		return err
+	}
+	return outbox.Enqueue(ctx, tx, models.POST_UPDATED, post)
+}
+
+// postETag: ETag que identifica la versión de un post
+func postETag(version int) string {
+	return fmt.Sprintf("\"%d\"", version)
+}
+
+// ifMatchVersion: obtiene la versión esperada del header If-Match del request, si no se envía
+// responde HTTP 428 y si ningún ETag es válido HTTP 412, en esos casos retorna false
+func ifMatchVersion(w http.ResponseWriter, r *http.Request) (int, bool) {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		http.Error(w, "If-Match header is required", http.StatusPreconditionRequired)
+		return 0, false
+	}
+	version, ok := parseIfMatch(ifMatch)
+	if !ok {
+		http.Error(w, repository.ErrVersionMismatch.Error(), http.StatusPreconditionFailed)
+		return 0, false
+	}
+	return version, true
+}
+
+// parseIfMatch: obtiene la versión esperada desde el header If-Match,
+// "*" acepta cualquier versión y se retorna 0, si ningún ETag es válido retorna false
+func parseIfMatch(value string) (int, bool) {
+	for _, tag := range strings.Split(value, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return 0, true
+		}
+		unquoted, err := strconv.Unquote(tag)
+		if err != nil {
+			continue
+		}
+		if version, err := strconv.Atoi(unquoted); err == nil && version > 0 {
+			return version, true
+		}
+	}
+	return 0, false
+}
+
+func DeletePostHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		claims, ok := auth.ClaimsFrom(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		err := s.Repository().WithTx(r.Context(), func(tx repository.Repository) error {
+			if err := tx.DeletePost(r.Context(), params["id"], claims.UserId); err != nil {
+				return err
 			}
-			post := models.Post{
-				Id:          params["id"],
-				PostContent: postRequest.PostContent,
-				UserId:      claims.UserId,
+			return outbox.Enqueue(r.Context(), tx, models.POST_DELETED, map[string]string{"id": params["id"]})
+		})
+		if err != nil {
+			http.Error(w, err.Error(), repositoryErrorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(PostUpdateResponse{
+			Menssage: "Post deleted",
+		})
+	}
+}
+
+// RestorePostHandler: endpoint para que el dueño restaure un post borrado
+// los casos son:
+// - si el post no existe, se retorna un response de error con HTTP 404
+// - si el post pertenece a otro usuario o lo borró un moderador, se retorna un response de error con HTTP 403
+// - si el post no está borrado, se retorna un response de error con HTTP 409
+// - si el post se borró hace más tiempo que el permitido para restaurarlo, se retorna un response de error con HTTP 410
+// - si es caso exitoso, se responde con un PostUpdateResponse con HTTP 200
+func RestorePostHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		claims, ok := auth.ClaimsFrom(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		deletedAfter := time.Now().Add(-s.Config().PostRestoreWindow)
+		err := s.Repository().WithTx(r.Context(), func(tx repository.Repository) error {
+			if err := tx.RestorePost(r.Context(), params["id"], claims.UserId, deletedAfter); err != nil {
+				return err
 			}
-			err = repository.UpdatePost(r.Context(), &post)
+			post, err := tx.GetPostById(r.Context(), params["id"])
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
+				return err
 			}
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(PostUpdateResponse{
-				Menssage: "Post updated",
-			})
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return outbox.Enqueue(r.Context(), tx, models.POST_RESTORED, post)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), repositoryErrorStatus(err))
 			return
 		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(PostUpdateResponse{
+			Menssage: "Post restored",
+		})
 	}
 }
 
-func DeletePostHandler(s server.Server) http.HandlerFunc {
+// ListPostHandler: endpoint para listar los posts ordenados por fecha de creación
+// los casos son:
+// - si se envía page, se mantiene el comportamiento anterior y se responde con el arreglo de posts
+// - si no, se pagina con cursor y se responde con un ListPostResponse que incluye next_cursor
+// - se puede filtrar por user_id, since y until (RFC3339) y ordenar con sort (oldest o newest)
+// - si page, limit, cursor o los filtros son inválidos, se retorna un response de error con HTTP 400
+// - si hay algún error con el repositorio, se retorna un response de error con HTTP 500
+func ListPostHandler(s server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		params := mux.Vars(r)
-		tokenString := strings.TrimSpace(r.Header.Get("Authorization"))
-		token, err := jwt.ParseWithClaims(tokenString, &models.AppClaims{}, func(token *jwt.Token) (interface{}, error) {
-			return []byte(s.Config().JWTSecret), nil
-		})
+		query := r.URL.Query()
+		limit, err := pageLimit(s.Config(), query.Get("limit"))
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		options, err := listPostFilters(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		if claims, ok := token.Claims.(*models.AppClaims); ok && token.Valid {
-			err = repository.DeletePost(r.Context(), params["id"], claims.UserId)
+		if pageStr := query.Get("page"); pageStr != "" && query.Get("cursor") == "" {
+			options.Page, err = strconv.ParseUint(pageStr, 10, 64)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			options.Limit = limit
+			posts, err := s.Repository().ListPost(r.Context(), options)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
 			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(PostUpdateResponse{
-				Menssage: "Post deleted",
-			})
-		} else {
+			json.NewEncoder(w).Encode(posts)
+			return
+		}
+		options.Limit = limit + 1 //un post extra para saber si hay otra página
+		if cursor := query.Get("cursor"); cursor != "" {
+			options.After, err = repository.DecodePostCursor(cursor)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		posts, err := s.Repository().ListPost(r.Context(), options)
+		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		response := ListPostResponse{
+			Posts: make([]*models.Post, 0, limit),
+		}
+		if len(posts) > limit {
+			posts = posts[:limit]
+			response.NextCursor = repository.CursorFromPost(posts[limit-1]).Encode()
+		}
+		response.Posts = append(response.Posts, posts...)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
 	}
 }
 
-func ListPostHandler(s server.Server) http.HandlerFunc {
+// SearchPostHandler: endpoint para buscar posts por su contenido
+// los casos son:
+// - si q viene vacío o page y limit son inválidos, se retorna un response de error con HTTP 400
+// - si hay algún error con el repositorio, se retorna un response de error con HTTP 500
+// - si es caso exitoso, se responde con un SearchPostResponse ordenado por relevancia con HTTP 200
+func SearchPostHandler(s server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var err error
-		pageStr := r.URL.Query().Get("page")
-		page := uint64(0)
-		if pageStr != "" {
-			page, err = strconv.ParseUint(pageStr, 10, 64)
+		query := r.URL.Query()
+		q := strings.TrimSpace(query.Get("q"))
+		if q == "" {
+			http.Error(w, "q is required", http.StatusBadRequest)
+			return
 		}
+		limit, err := pageLimit(s.Config(), query.Get("limit"))
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		posts, err := repository.ListPost(r.Context(), page)
+		page := uint64(0)
+		if pageStr := query.Get("page"); pageStr != "" {
+			page, err = strconv.ParseUint(pageStr, 10, 64)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		results, err := repository.SearchPosts(r.Context(), s.Repository(), repository.SearchPostOptions{
+			Query:  q,
+			Offset: page * uint64(limit),
+			Limit:  limit + 1, //un resultado extra para saber si hay otra página
+		})
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		response := SearchPostResponse{
+			Results: make([]*models.PostSearchResult, 0, limit),
+		}
+		if len(results) > limit {
+			results = results[:limit]
+			nextPage := page + 1
+			response.NextPage = &nextPage
+		}
+		response.Results = append(response.Results, results...)
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(posts)
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// listPostFilters: obtiene los filtros y el orden del listado desde el query string
+func listPostFilters(query url.Values) (repository.ListPostOptions, error) {
+	options := repository.ListPostOptions{
+		UserId: query.Get("user_id"),
+		Sort:   repository.SortOldest,
+	}
+	if sort := query.Get("sort"); sort != "" {
+		options.Sort = repository.PostSort(sort)
+		if options.Sort != repository.SortOldest && options.Sort != repository.SortNewest {
+			return options, errors.New("sort must be oldest or newest")
+		}
+	}
+	var err error
+	if options.Since, err = dateParam(query, "since"); err != nil {
+		return options, err
+	}
+	if options.Until, err = dateParam(query, "until"); err != nil {
+		return options, err
+	}
+	if options.Since != nil && options.Until != nil && options.Since.After(*options.Until) {
+		return options, errors.New("since must be before until")
+	}
+	return options, nil
+}
+
+// dateParam: obtiene una fecha RFC3339 del query string, si no viene retorna nil
+func dateParam(query url.Values, name string) (*time.Time, error) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	date, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a RFC3339 date", name)
+	}
+	return &date, nil
+}
+
+// pageLimit: obtiene la cantidad de posts a listar, si el cliente no la envía se usa
+// la configurada en el servidor y nunca se supera el máximo permitido
+func pageLimit(config *server.Config, value string) (int, error) {
+	if value == "" {
+		return config.PageSize, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		return 0, errors.New("limit must be a positive number")
+	}
+	if limit > config.MaxPageSize {
+		limit = config.MaxPageSize
+	}
+	return limit, nil
+}
+
+// repositoryErrorStatus: traduce los errores del repositorio a códigos HTTP
+// - el registro no existe, HTTP 404
+// - el registro pertenece a otro usuario, HTTP 403
+// - el registro no está borrado, HTTP 409
+// - el plazo para restaurar el registro expiró, HTTP 410
+// - el registro cambió de versión, HTTP 412
+// - cualquier otro error, HTTP 500
+func repositoryErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, repository.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, repository.ErrNotDeleted):
+		return http.StatusConflict
+	case errors.Is(err, repository.ErrRestoreExpired):
+		return http.StatusGone
+	case errors.Is(err, repository.ErrVersionMismatch):
+		return http.StatusPreconditionFailed
+	default:
+		return http.StatusInternalServerError
 	}
 }
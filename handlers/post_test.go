@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseIfMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		version int
+		ok      bool
+	}{
+		{"strong etag", `"3"`, 3, true},
+		{"any version", "*", 0, true},
+		{"list with one valid", `"abc", "2"`, 2, true},
+		{"weak etag", `W/"1"`, 0, false},
+		{"unquoted", "1", 0, false},
+		{"not a number", `"abc"`, 0, false},
+		{"zero", `"0"`, 0, false},
+		{"negative", `"-1"`, 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			version, ok := parseIfMatch(test.value)
+			if version != test.version || ok != test.ok {
+				t.Errorf("parseIfMatch(%q) = %d, %v, want %d, %v", test.value, version, ok, test.version, test.ok)
+			}
+		})
+	}
+}
+
+func TestIfMatchVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		ifMatch string
+		version int
+		status  int
+	}{
+		{"missing", "", 0, http.StatusPreconditionRequired},
+		{"invalid", `W/"1"`, 0, http.StatusPreconditionFailed},
+		{"valid", `"4"`, 4, http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, "/api/v1/posts/1", nil)
+			if test.ifMatch != "" {
+				r.Header.Set("If-Match", test.ifMatch)
+			}
+			w := httptest.NewRecorder()
+			version, ok := ifMatchVersion(w, r)
+			if ok != (test.status == http.StatusOK) || version != test.version {
+				t.Errorf("ifMatchVersion() = %d, %v, want %d", version, ok, test.version)
+			}
+			if w.Code != test.status {
+				t.Errorf("status = %d, want %d", w.Code, test.status)
+			}
+		})
+	}
+}
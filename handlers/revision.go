@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"w00k/go/rest-ws/auth"
+	"w00k/go/rest-ws/diff"
+	"w00k/go/rest-ws/models"
+	"w00k/go/rest-ws/repository"
+	"w00k/go/rest-ws/server"
+
+	"github.com/gorilla/mux"
+)
+
+type RevisionDiffResponse struct {
+	From    int           `json:"from"`
+	To      int           `json:"to"`
+	Changes []diff.Change `json:"changes"`
+}
+
+// ListPostRevisionsHandler: endpoint para obtener el historial de revisiones de un post
+// los casos son:
+// - si el post no existe o está borrado, se retorna un response de error con HTTP 404
+// - si hay algún error con el repositorio, se retorna un response de error con HTTP 500
+// - si es caso exitoso, se responde con las revisiones de la más antigua a la más nueva con HTTP 200
+func ListPostRevisionsHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		if _, err := s.Repository().GetPostById(r.Context(), params["id"]); err != nil {
+			http.Error(w, err.Error(), repositoryErrorStatus(err))
+			return
+		}
+		revisions, err := s.Repository().ListPostRevisions(r.Context(), params["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if revisions == nil {
+			revisions = make([]*models.PostRevision, 0)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(revisions)
+	}
+}
+
+// DiffPostRevisionsHandler: endpoint para comparar dos revisiones de un post (?from=&to=)
+// los casos son:
+// - si from o to no son números, se retorna un response de error con HTTP 400
+// - si el post o alguna de las revisiones no existe, se retorna un response de error con HTTP 404
+// - si es caso exitoso, se responde con un RevisionDiffResponse con HTTP 200
+func DiffPostRevisionsHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		query := r.URL.Query()
+		from, errFrom := strconv.Atoi(query.Get("from"))
+		to, errTo := strconv.Atoi(query.Get("to"))
+		if errFrom != nil || errTo != nil {
+			http.Error(w, "from and to must be revision numbers", http.StatusBadRequest)
+			return
+		}
+		if _, err := s.Repository().GetPostById(r.Context(), params["id"]); err != nil {
+			http.Error(w, err.Error(), repositoryErrorStatus(err))
+			return
+		}
+		fromRevision, err := s.Repository().GetPostRevision(r.Context(), params["id"], from)
+		if err != nil {
+			http.Error(w, err.Error(), repositoryErrorStatus(err))
+			return
+		}
+		toRevision, err := s.Repository().GetPostRevision(r.Context(), params["id"], to)
+		if err != nil {
+			http.Error(w, err.Error(), repositoryErrorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(RevisionDiffResponse{
+			From:    from,
+			To:      to,
+			Changes: diff.Words(fromRevision.PostContent, toRevision.PostContent),
+		})
+	}
+}
+
+// RevertPostHandler: endpoint para que el dueño vuelva el post al contenido de una revisión anterior,
+// la reversión se guarda como una nueva revisión y, como al editar, requiere el header If-Match
+// los casos son:
+// - si el número de revisión es inválido, se retorna un response de error con HTTP 400
+// - si no se envía el header If-Match, se retorna un response de error con HTTP 428
+// - si el post cambió de versión, se retorna un response de error con HTTP 412
+// - si el post o la revisión no existe, se retorna un response de error con HTTP 404
+// - si el post pertenece a otro usuario, se retorna un response de error con HTTP 403
+// - si es caso exitoso, se responde con un PostUpdateResponse y el ETag de la nueva versión con HTTP 200
+func RevertPostHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		number, err := strconv.Atoi(params["revision"])
+		if err != nil {
+			http.Error(w, "revision must be a number", http.StatusBadRequest)
+			return
+		}
+		claims, ok := auth.ClaimsFrom(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		version, ok := ifMatchVersion(w, r)
+		if !ok {
+			return
+		}
+		post := models.Post{
+			Id:      params["id"],
+			UserId:  claims.UserId,
+			Version: version,
+		}
+		err = s.Repository().WithTx(r.Context(), func(tx repository.Repository) error {
+			revision, err := tx.GetPostRevision(r.Context(), post.Id, number)
+			if err != nil {
+				return err
+			}
+			post.PostContent = revision.PostContent
+			return updatePost(r.Context(), tx, &post)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), repositoryErrorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", postETag(post.Version))
+		json.NewEncoder(w).Encode(PostUpdateResponse{
+			Menssage: "Post reverted",
+		})
+	}
+}
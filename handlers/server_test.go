@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"w00k/go/rest-ws/mailer"
+	"w00k/go/rest-ws/models"
+	"w00k/go/rest-ws/repository"
+	"w00k/go/rest-ws/server"
+)
+
+// stubRepository: implementa solo los métodos que usan las pruebas, el resto entra en pánico
+type stubRepository struct {
+	repository.Repository
+	mutex       sync.Mutex
+	users       []*models.User
+	resetTokens []*models.PasswordResetToken
+	verified    []string
+	// refreshTokens: tokens que retorna GetRefreshToken, revokedFamilies registra RevokeRefreshTokenFamily
+	refreshTokens   []*models.RefreshToken
+	revokedFamilies []string
+	// block: si no es nil, GetUserByEmail espera a que se cierre
+	block chan struct{}
+}
+
+func (repo *stubRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	if repo.block != nil {
+		<-repo.block
+	}
+	for _, user := range repo.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return &models.User{}, nil
+}
+
+func (repo *stubRepository) GetUserById(ctx context.Context, id string) (*models.User, error) {
+	for _, user := range repo.users {
+		if user.Id == id {
+			return user, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (repo *stubRepository) GetRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	for _, token := range repo.refreshTokens {
+		if token.TokenHash == tokenHash {
+			return token, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (repo *stubRepository) RevokeRefreshTokenFamily(ctx context.Context, familyId string) error {
+	repo.revokedFamilies = append(repo.revokedFamilies, familyId)
+	return nil
+}
+
+func (repo *stubRepository) MarkEmailVerified(ctx context.Context, userId string, email string) error {
+	for _, user := range repo.users {
+		if user.Id == userId && user.Email == email {
+			repo.verified = append(repo.verified, userId)
+			return nil
+		}
+	}
+	return repository.ErrNotFound
+}
+
+func (repo *stubRepository) InsertPasswordResetToken(ctx context.Context, token *models.PasswordResetToken) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	repo.resetTokens = append(repo.resetTokens, token)
+	return nil
+}
+
+// channelMailer: entrega los correos enviados en un canal
+type channelMailer chan mailer.Message
+
+func (m channelMailer) Send(ctx context.Context, message mailer.Message) error {
+	m <- message
+	return nil
+}
+
+// newTestServer: servidor con el repositorio y el mailer de prueba, sin conectarse a la base de datos
+func newTestServer(t *testing.T, config *server.Config, repo repository.Repository) (*server.Broker, channelMailer) {
+	t.Helper()
+	config.Port = ":5050"
+	config.DataUrl = "postgres://localhost/test"
+	config.JWTSecret = "secret"
+	s, err := server.NewServer(context.Background(), config)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	m := make(channelMailer, 1)
+	s.UseRepository(repo)
+	s.UseMailer(m)
+	return s, m
+}
@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+	"w00k/go/rest-ws/auth"
+	"w00k/go/rest-ws/models"
+	"w00k/go/rest-ws/repository"
+	"w00k/go/rest-ws/server"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/segmentio/ksuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	REFRESH_TOKEN_BYTES = 32
+)
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// TokenResponse: access token (JWT) y refresh token, ExpiresIn es la duración del access token en segundos
+type TokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// RefreshTokenHandler: endpoint para obtener un nuevo access token con un refresh token,
+// el refresh token se reemplaza por uno nuevo en cada uso (rotación)
+// los casos son:
+// - si el request es inválido, se retorna un response de error con HTTP 400
+// - si el refresh token no existe, está revocado o expiró, se retorna un response de error con HTTP 401
+// - si el usuario está deshabilitado, se retorna un response de error con HTTP 403
+// - si el refresh token ya se usó, se revoca toda su familia (posible robo) y se retorna un response de error con HTTP 401
+// - si hay algún error con el repositorio, se retorna un response de error con HTTP 500
+// - si es caso exitoso, se responde con un TokenResponse con HTTP 200
+func RefreshTokenHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request = RefreshTokenRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if request.RefreshToken == "" {
+			http.Error(w, "refresh_token is required", http.StatusBadRequest)
+			return
+		}
+		current, err := s.Repository().GetRefreshToken(r.Context(), hashToken(request.RefreshToken))
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if current.RevokedAt != nil || time.Now().After(current.ExpiresAt) {
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+		user, err := s.Repository().GetUserById(r.Context(), current.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if user.DisabledAt != nil {
+			http.Error(w, "User is disabled", http.StatusForbidden)
+			return
+		}
+		var response TokenResponse
+		err = repository.ErrTokenUsed
+		if current.UsedAt == nil {
+			err = s.Repository().WithTx(r.Context(), func(tx repository.Repository) error {
+				if err := tx.UseRefreshToken(r.Context(), current.Id); err != nil {
+					return err
+				}
+				tokens, err := issueTokens(r.Context(), s, tx, user, current.FamilyId)
+				response = tokens
+				return err
+			})
+		}
+		if errors.Is(err, repository.ErrTokenUsed) {
+			// el token ya se había usado: alguien más lo tiene, se revocan todos los tokens del login
+			log.Printf("refresh token reused: user=%s family=%s\n", current.UserId, current.FamilyId)
+			if err := s.Repository().RevokeRefreshTokenFamily(r.Context(), current.FamilyId); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// LogoutHandler: endpoint para cerrar la sesión actual, revoca el access token enviado y,
+// si se envía el refresh_token, todos los refresh tokens obtenidos desde el mismo login
+// los casos son:
+// - si el token es inválido, se retorna un response de error con HTTP 401
+// - si el request es inválido, se retorna un response de error con HTTP 400
+// - si hay algún error con el repositorio, se retorna un response de error con HTTP 500
+// - si es caso exitoso, se responde con un MessageResponse con HTTP 200
+func LogoutHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := auth.ClaimsFrom(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var request = RefreshTokenRequest{}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		err := s.Repository().WithTx(r.Context(), func(tx repository.Repository) error {
+			if claims.Id != "" {
+				if err := tx.RevokeToken(r.Context(), claims.Id, claims.UserId, time.Unix(claims.ExpiresAt, 0)); err != nil {
+					return err
+				}
+			}
+			if request.RefreshToken == "" {
+				return nil
+			}
+			refreshToken, err := tx.GetRefreshToken(r.Context(), hashToken(request.RefreshToken))
+			if errors.Is(err, repository.ErrNotFound) || (err == nil && refreshToken.UserId != claims.UserId) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			return tx.RevokeRefreshTokenFamily(r.Context(), refreshToken.FamilyId)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(MessageResponse{
+			Message: "Logged out",
+		})
+	}
+}
+
+// LogoutAllHandler: endpoint para cerrar todas las sesiones del usuario, invalida todos
+// sus access tokens emitidos hasta ahora y revoca todos sus refresh tokens
+// los casos son:
+// - si el token es inválido, se retorna un response de error con HTTP 401
+// - si hay algún error con el repositorio, se retorna un response de error con HTTP 500
+// - si es caso exitoso, se responde con un MessageResponse con HTTP 200
+func LogoutAllHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := auth.ClaimsFrom(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if err := s.Repository().RevokeUserTokens(r.Context(), claims.UserId, time.Now()); err != nil {
+			http.Error(w, err.Error(), repositoryErrorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(MessageResponse{
+			Message: "Logged out from all sessions",
+		})
+	}
+}
+
+// ChangePasswordHandler: endpoint para cambiar la contraseña, al cambiarla se cierran todas las
+// sesiones del usuario y se responde con tokens nuevos para la sesión actual
+// los casos son:
+// - si el token es inválido, se retorna un response de error con HTTP 401
+// - si el request es inválido, se retorna un response de error con HTTP 400
+// - si la contraseña nueva no cumple la policy, se retorna un ValidationErrorResponse con HTTP 400
+// - si la contraseña actual no coincide, se retorna un response de error con HTTP 403
+// - si hay algún error con el repositorio, se retorna un response de error con HTTP 500
+// - si es caso exitoso, se responde con un TokenResponse con HTTP 200
+func ChangePasswordHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := auth.ClaimsFrom(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var request = ChangePasswordRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var errs validationErrors
+		errs.add("new_password", s.PasswordPolicy().Validate(request.NewPassword))
+		if errs.write(w) {
+			return
+		}
+		user, err := s.Repository().GetUserById(r.Context(), claims.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		current, err := s.Repository().GetUserByEmail(r.Context(), user.Email)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(current.Password), []byte(request.CurrentPassword)); err != nil {
+			http.Error(w, "Invalid credentials", http.StatusForbidden)
+			return
+		}
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(request.NewPassword), HASH_COST)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var response TokenResponse
+		err = s.Repository().WithTx(r.Context(), func(tx repository.Repository) error {
+			if err := tx.UpdateUserPassword(r.Context(), claims.UserId, string(hashedPassword)); err != nil {
+				return err
+			}
+			if err := tx.RevokeUserTokens(r.Context(), claims.UserId, time.Now()); err != nil {
+				return err
+			}
+			tokens, err := issueTokens(r.Context(), s, tx, current, "")
+			response = tokens
+			return err
+		})
+		if err != nil {
+			http.Error(w, err.Error(), repositoryErrorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// JWKSHandler: endpoint con las llaves públicas vigentes para validar los tokens (RS256/ES256),
+// los clientes pueden guardarlo en caché por poco tiempo porque las llaves rotan
+func JWKSHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(w).Encode(s.Keys().JWKS())
+	}
+}
+
+// issueTokens: firma un access token con el rol del usuario y guarda un nuevo refresh token
+// de la familia indicada, con familyId vacío se inicia una nueva familia (login)
+func issueTokens(ctx context.Context, s server.Server, repo repository.Repository, user *models.User, familyId string) (TokenResponse, error) {
+	userId := user.Id
+	now := time.Now()
+	jti, err := ksuid.NewRandom()
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	claims := models.AppClaims{
+		UserId: userId,
+		Role:   user.Role,
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti.String(),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(s.Config().AccessTokenTTL).Unix(),
+		},
+	}
+	tokenString, err := s.Keys().Sign(claims)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	refreshToken, err := newOpaqueToken()
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	id, err := ksuid.NewRandom()
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	if familyId == "" {
+		familyId = id.String()
+	}
+	err = repo.InsertRefreshToken(ctx, &models.RefreshToken{
+		Id:        id.String(),
+		TokenHash: hashToken(refreshToken),
+		UserId:    userId,
+		FamilyId:  familyId,
+		ExpiresAt: now.Add(s.Config().RefreshTokenTTL),
+	})
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	return TokenResponse{
+		Token:        tokenString,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.Config().AccessTokenTTL / time.Second),
+	}, nil
+}
+
+// newOpaqueToken: token aleatorio opaco para enviar al cliente (refresh tokens y links de reset)
+func newOpaqueToken() (string, error) {
+	data := make([]byte, REFRESH_TOKEN_BYTES)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// hashToken: hash con el que se guardan los tokens, así una filtración de la base de datos no permite usarlos
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
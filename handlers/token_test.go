@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"w00k/go/rest-ws/models"
+	"w00k/go/rest-ws/server"
+)
+
+func TestRefreshTokenHandlerRejectsToken(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name          string
+		token         *models.RefreshToken
+		revokesFamily bool
+	}{
+		{
+			name:          "reused token",
+			token:         &models.RefreshToken{UsedAt: &now, ExpiresAt: now.Add(time.Hour)},
+			revokesFamily: true,
+		},
+		{
+			name:  "revoked token",
+			token: &models.RefreshToken{RevokedAt: &now, ExpiresAt: now.Add(time.Hour)},
+		},
+		{
+			name:  "expired token",
+			token: &models.RefreshToken{ExpiresAt: now.Add(-time.Minute)},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.token.Id = "token"
+			test.token.TokenHash = hashToken("refresh")
+			test.token.UserId = "user"
+			test.token.FamilyId = "family"
+			repo := &stubRepository{
+				users:         []*models.User{{Id: "user", Email: "user@mail.com"}},
+				refreshTokens: []*models.RefreshToken{test.token},
+			}
+			s, _ := newTestServer(t, &server.Config{}, repo)
+			r := httptest.NewRequest(http.MethodPost, "/token/refresh", strings.NewReader(`{"refresh_token":"refresh"}`))
+			w := httptest.NewRecorder()
+			RefreshTokenHandler(s)(w, r)
+
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+			}
+			revoked := len(repo.revokedFamilies) == 1 && repo.revokedFamilies[0] == "family"
+			if test.revokesFamily != revoked {
+				t.Errorf("revoked families = %v, want family revoked = %v", repo.revokedFamilies, test.revokesFamily)
+			}
+		})
+	}
+}
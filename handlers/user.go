@@ -3,14 +3,13 @@ package handlers
 import (
 	"encoding/json"
 	"log"
+	"math"
 	"net/http"
-	"strings"
-	"time"
+	"strconv"
+	"w00k/go/rest-ws/auth"
 	"w00k/go/rest-ws/models"
-	"w00k/go/rest-ws/repository"
 	"w00k/go/rest-ws/server"
 
-	"github.com/golang-jwt/jwt"
 	"github.com/segmentio/ksuid"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -29,16 +28,15 @@ type SignUpResponse struct {
 	Email string `json:"email"`
 }
 
-type LoginResponse struct {
-	Token string `json:"token"`
-}
-
-// SignUpHandler: endpoint para insertar un user en la base de datos
+// SignUpHandler: endpoint para insertar un user en la base de datos, el correo se guarda
+// sin espacios y en minúsculas
 // los casos son:
 // - si el request es inválido, se retorna un response de error con HTTP 400
-// - si no se puede generar el id, se retorna un resopnse de error con HTTP 500
+// - si el correo es inválido o la contraseña no cumple la policy, se retorna un ValidationErrorResponse con HTTP 400
+// - si no se puede generar el hash de la contraseña o el id, se retorna un response de error con HTTP 500
 // - si hay algún error con el repositorio al insertar el user, se retorna un response de error con HTTP 500
-// - si es caso exitoso, se responde con un SignUpResponse con HTTP 200
+// - si es caso exitoso, se envía el correo de verificación y se responde con un SignUpResponse con HTTP 200,
+// si el correo falla el usuario puede pedir otro link en /api/v1/verify/resend
 func SignUpHandler(s server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var request = SignUpLoginRequest{}
@@ -47,28 +45,41 @@ func SignUpHandler(s server.Server) http.HandlerFunc {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		email := auth.NormalizeEmail(request.Email)
+		var errs validationErrors
+		errs.add("email", auth.ValidateEmail(email))
+		errs.add("password", s.PasswordPolicy().Validate(request.Password))
+		if errs.write(w) {
+			return
+		}
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(request.Password), HASH_COST)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
 		id, err := ksuid.NewRandom()
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
 		var user = models.User{
-			Email:    request.Email,
+			Email:    email,
 			Password: string(hashedPassword),
 			Id:       id.String(),
 		}
-		err = repository.InsertUser(r.Context(), &user)
+		err = s.Repository().InsertUser(r.Context(), &user)
 		if err != nil {
-			if err.Error() == "pq: duplicate key value violates unique constraint \"users_email_key\"" {
+			if err.Error() == "pq: duplicate key value violates unique constraint \"users_email_key\"" ||
+				err.Error() == "pq: duplicate key value violates unique constraint \"users_email_lower_idx\"" {
 				http.Error(w, "User is in use", http.StatusConflict)
 				return
 			}
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		if err := sendVerificationEmail(r.Context(), s, &user); err != nil {
+			log.Println("verification email: ", err)
+		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(SignUpResponse{
 			Id:    user.Id,
@@ -77,6 +88,16 @@ func SignUpHandler(s server.Server) http.HandlerFunc {
 	}
 }
 
+// LoginHandler: endpoint para loguearse con correo y contraseña, los intentos fallidos se cuentan
+// por cuenta y por ip, y después de LoginMaxAttempts (o LoginIpMaxAttempts) fallos cada nuevo fallo
+// bloquea temporalmente la cuenta o la ip
+// los casos son:
+// - si el request es inválido, se retorna un response de error con HTTP 400
+// - si la cuenta o la ip están bloqueadas, se retorna un response de error con HTTP 429 y el header Retry-After
+// - si el correo no existe o la contraseña no coincide, se retorna un response de error con HTTP 401
+// - si el usuario está deshabilitado, se retorna un response de error con HTTP 403
+// - si hay algún error con el repositorio, se retorna un response de error con HTTP 500
+// - si es caso exitoso, se responde con un TokenResponse con HTTP 200
 func LoginHandler(s server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var request = SignUpLoginRequest{}
@@ -85,60 +106,73 @@ func LoginHandler(s server.Server) http.HandlerFunc {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		user, err := repository.GetUserByEmail(r.Context(), request.Email)
+		email := auth.NormalizeEmail(request.Email)
+		//el intento se cuenta como fallido antes de validar la contraseña, así los requests
+		//concurrentes no pueden hacer más intentos que los permitidos
+		accountKey, ipKey := loginKeys(s, r, email)
+		accountLimit, ipLimit := loginLimits(s)
+		locked, err := reserveLoginAttempt(r.Context(), s, accountKey, accountLimit)
+		if err == nil && locked == 0 {
+			locked, err = reserveLoginAttempt(r.Context(), s, ipKey, ipLimit)
+			if err != nil || locked > 0 {
+				releaseLoginAttempt(r.Context(), s, accountKey)
+			}
+		}
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		if user == nil {
-			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		if locked > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(locked.Seconds()))))
+			http.Error(w, "Too many failed login attempts", http.StatusTooManyRequests)
 			return
 		}
-		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(request.Password)); err != nil {
-			log.Println(err)
+		user, err := s.Repository().GetUserByEmail(r.Context(), email)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if user.Id == "" {
+			compareDummyPassword(request.Password)
+			err = bcrypt.ErrMismatchedHashAndPassword
+		} else {
+			err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(request.Password))
+		}
+		if err != nil {
 			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 			return
 		}
-		claims := models.AppClaims{
-			UserId: user.Id,
-			StandardClaims: jwt.StandardClaims{
-				ExpiresAt: time.Now().Add(2 * time.Hour * 24).Unix(),
-			},
+		if err := s.Repository().ResetLoginAttempts(r.Context(), accountKey); err != nil {
+			log.Println("login attempts: ", err)
 		}
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims) //creando el token
-		tokenString, err := token.SignedString([]byte(s.Config().JWTSecret))
+		releaseLoginAttempt(r.Context(), s, ipKey)
+		if user.DisabledAt != nil {
+			http.Error(w, "User is disabled", http.StatusForbidden)
+			return
+		}
+		response, err := issueTokens(r.Context(), s, s.Repository(), user, "")
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(LoginResponse{
-			Token: tokenString,
-		})
+		json.NewEncoder(w).Encode(response)
 	}
 }
 
 func MeHandler(s server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		tokenString := strings.TrimSpace(r.Header.Get("Authorization"))
-		token, err := jwt.ParseWithClaims(tokenString, &models.AppClaims{}, func(token *jwt.Token) (interface{}, error) {
-			return []byte(s.Config().JWTSecret), nil
-		})
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
+		claims, ok := auth.ClaimsFrom(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
-		if claims, ok := token.Claims.(*models.AppClaims); ok && token.Valid {
-			user, err := repository.GetUserById(r.Context(), claims.UserId)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(user)
-		} else {
+		user, err := s.Repository().GetUserById(r.Context(), claims.UserId)
+		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(user)
 	}
 }
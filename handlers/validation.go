@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// FieldError: error de validación de un campo del request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type ValidationErrorResponse struct {
+	Message string       `json:"message"`
+	Errors  []FieldError `json:"errors"`
+}
+
+// validationErrors: acumula los errores de validación de un request para responderlos todos juntos
+type validationErrors []FieldError
+
+func (errs *validationErrors) add(field string, err error) {
+	if err != nil {
+		*errs = append(*errs, FieldError{Field: field, Message: err.Error()})
+	}
+}
+
+// write: si hay errores responde un ValidationErrorResponse con HTTP 400 y retorna true
+func (errs validationErrors) write(w http.ResponseWriter) bool {
+	if len(errs) == 0 {
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(ValidationErrorResponse{
+		Message: "Invalid request",
+		Errors:  errs,
+	})
+	return true
+}
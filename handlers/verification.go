@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+	"w00k/go/rest-ws/auth"
+	"w00k/go/rest-ws/mailer"
+	"w00k/go/rest-ws/models"
+	"w00k/go/rest-ws/repository"
+	"w00k/go/rest-ws/server"
+)
+
+// sendVerificationEmail: envía al usuario el link para verificar su correo,
+// el token incluye el correo para que deje de servir si el usuario lo cambia
+func sendVerificationEmail(ctx context.Context, s server.Server, user *models.User) error {
+	expiresAt := time.Now().Add(s.Config().VerificationTTL)
+	token, err := s.Signer().Sign(auth.PURPOSE_VERIFY_EMAIL, user.Id, user.Email, expiresAt)
+	if err != nil {
+		return err
+	}
+	link := s.Config().PublicUrl + "/verify?token=" + url.QueryEscape(token)
+	return s.Mailer().Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email",
+		Body:    fmt.Sprintf("Open this link to verify your email:\n\n%s\n\nThe link expires in %s.\n", link, s.Config().VerificationTTL),
+	})
+}
+
+// VerifyEmailHandler: endpoint del link de verificación que se envía por correo, el token va en el parámetro token
+// los casos son:
+// - si el token no existe o es inválido, se retorna un response de error con HTTP 400
+// - si el token expiró, se retorna un response de error con HTTP 410
+// - si el usuario no existe o cambió su correo, se retorna un response de error con HTTP 404
+// - si hay algún error con el repositorio, se retorna un response de error con HTTP 500
+// - si es caso exitoso, se responde con un MessageResponse con HTTP 200
+func VerifyEmailHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, email, err := s.Signer().Verify(auth.PURPOSE_VERIFY_EMAIL, r.URL.Query().Get("token"))
+		if errors.Is(err, auth.ErrExpiredToken) {
+			http.Error(w, "Verification link expired", http.StatusGone)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Invalid verification link", http.StatusBadRequest)
+			return
+		}
+		if err := s.Repository().MarkEmailVerified(r.Context(), userId, email); err != nil {
+			http.Error(w, err.Error(), repositoryErrorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(MessageResponse{
+			Message: "Email verified",
+		})
+	}
+}
+
+// ResendVerificationHandler: endpoint para que el usuario autenticado pida un nuevo link de verificación
+// los casos son:
+// - si el usuario no existe, se retorna un response de error con HTTP 404
+// - si el correo ya está verificado, se retorna un response de error con HTTP 409
+// - si hay algún error con el repositorio o al enviar el correo, se retorna un response de error con HTTP 500
+// - si es caso exitoso, se responde con un MessageResponse con HTTP 200
+func ResendVerificationHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := s.Repository().GetUserById(r.Context(), auth.UserIdFrom(r.Context()))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if user.Id == "" {
+			http.Error(w, repository.ErrNotFound.Error(), http.StatusNotFound)
+			return
+		}
+		if user.EmailVerifiedAt != nil {
+			http.Error(w, "Email already verified", http.StatusConflict)
+			return
+		}
+		if err := sendVerificationEmail(r.Context(), s, user); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(MessageResponse{
+			Message: "Verification email sent",
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+	"w00k/go/rest-ws/auth"
+	"w00k/go/rest-ws/models"
+	"w00k/go/rest-ws/server"
+)
+
+func TestVerifyEmailHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		email     string
+		expiresIn time.Duration
+		token     string
+		status    int
+	}{
+		{"valid link", "user@mail.com", time.Hour, "", http.StatusOK},
+		{"expired link", "user@mail.com", -time.Hour, "", http.StatusGone},
+		{"email changed", "old@mail.com", time.Hour, "", http.StatusNotFound},
+		{"invalid link", "", 0, "not-a-token", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo := &stubRepository{users: []*models.User{{Id: "user", Email: "user@mail.com"}}}
+			s, _ := newTestServer(t, &server.Config{}, repo)
+			token := test.token
+			if token == "" {
+				var err error
+				token, err = s.Signer().Sign(auth.PURPOSE_VERIFY_EMAIL, "user", test.email, time.Now().Add(test.expiresIn))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			r := httptest.NewRequest(http.MethodGet, "/verify?token="+url.QueryEscape(token), nil)
+			w := httptest.NewRecorder()
+			VerifyEmailHandler(s)(w, r)
+
+			if w.Code != test.status {
+				t.Errorf("status = %d, want %d: %s", w.Code, test.status, w.Body.String())
+			}
+			if verified := len(repo.verified) == 1; verified != (test.status == http.StatusOK) {
+				t.Errorf("verified users = %v", repo.verified)
+			}
+		})
+	}
+}
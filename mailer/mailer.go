@@ -0,0 +1,105 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message: correo de texto plano
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer: envía correos, hay una implementación SMTP y una local para desarrollo y pruebas
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPMailer: envía los correos a un servidor SMTP, usa STARTTLS si el servidor lo soporta
+type SMTPMailer struct {
+	config SMTPConfig
+}
+
+func NewSMTPMailer(config SMTPConfig) *SMTPMailer {
+	if config.Port == 0 {
+		config.Port = 587
+	}
+	return &SMTPMailer{config: config}
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, message Message) error {
+	var auth smtp.Auth
+	if m.config.Username != "" {
+		auth = smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)
+	}
+	addr := fmt.Sprintf("%s:%d", m.config.Host, m.config.Port)
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(addr, auth, m.config.From, []string{message.To}, format(m.config.From, message))
+	}()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-done:
+		return err
+	}
+}
+
+// LocalMailer: escribe los correos en un archivo o en el log en lugar de enviarlos,
+// sirve para desarrollo y pruebas (los links de verificación quedan a la vista)
+type LocalMailer struct {
+	mutex sync.Mutex
+	from  string
+	out   io.Writer
+}
+
+// NewLocalMailer: con path vacío escribe los correos en el log, si no los agrega al archivo
+func NewLocalMailer(from string, path string) (*LocalMailer, error) {
+	if path == "" {
+		return &LocalMailer{from: from, out: log.Writer()}, nil
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &LocalMailer{from: from, out: file}, nil
+}
+
+func (m *LocalMailer) Send(ctx context.Context, message Message) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	_, err := fmt.Fprintf(m.out, "----- %s -----\n%s\n", time.Now().Format(time.RFC3339), format(m.from, message))
+	return err
+}
+
+// format: correo en formato RFC 5322, se quitan los saltos de línea de los headers
+// para que un destinatario o asunto no pueda agregar headers
+func format(from string, message Message) []byte {
+	header := strings.NewReplacer("\r", "", "\n", "")
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "From: %s\r\n", header.Replace(from))
+	fmt.Fprintf(&builder, "To: %s\r\n", header.Replace(message.To))
+	fmt.Fprintf(&builder, "Subject: %s\r\n", header.Replace(message.Subject))
+	builder.WriteString("MIME-Version: 1.0\r\n")
+	builder.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	builder.WriteString(message.Body)
+	return []byte(builder.String())
+}
@@ -5,6 +5,11 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+	"w00k/go/rest-ws/auth"
+	"w00k/go/rest-ws/database"
 	"w00k/go/rest-ws/handlers"
 	"w00k/go/rest-ws/middleware"
 	"w00k/go/rest-ws/server"
@@ -22,32 +27,195 @@ func main() {
 
 	PORT := os.Getenv("PORT")
 	JWT_SECRET := os.Getenv("JWT_SECRET")
+	JWT_ALGORITHM := os.Getenv("JWT_ALGORITHM")
+	JWT_PRIVATE_KEY_FILES := listEnv("JWT_PRIVATE_KEY_FILES")
+	JWT_KEY_ROTATION := durationEnv("JWT_KEY_ROTATION")
+	JWT_KEY_OVERLAP := durationEnv("JWT_KEY_OVERLAP")
 	DATABASE_URL := os.Getenv("DATABASE_URL")
+	PAGE := intEnv("PAGE")
+	PAGE_MAX := intEnv("PAGE_MAX")
+	DATABASE_REPLICA_URLS := listEnv("DATABASE_REPLICA_URLS")
+	READ_YOUR_WRITES := os.Getenv("READ_YOUR_WRITES") == "true"
+	DB_MAX_OPEN_CONNS := intEnv("DB_MAX_OPEN_CONNS")
+	DB_MAX_IDLE_CONNS := intEnv("DB_MAX_IDLE_CONNS")
+	DB_CONN_MAX_LIFETIME := durationEnv("DB_CONN_MAX_LIFETIME")
+	DB_CONN_MAX_IDLE_TIME := durationEnv("DB_CONN_MAX_IDLE_TIME")
+	DB_CONNECT_RETRIES := intEnv("DB_CONNECT_RETRIES")
+	SLOW_QUERY_THRESHOLD := durationEnv("SLOW_QUERY_THRESHOLD")
+	ACCESS_TOKEN_TTL := durationEnv("ACCESS_TOKEN_TTL")
+	REFRESH_TOKEN_TTL := durationEnv("REFRESH_TOKEN_TTL")
+	PUBLIC_URL := os.Getenv("PUBLIC_URL")
+	VERIFICATION_SECRET := os.Getenv("VERIFICATION_SECRET")
+	VERIFICATION_TTL := durationEnv("VERIFICATION_TTL")
+	PASSWORD_RESET_TTL := durationEnv("PASSWORD_RESET_TTL")
+	PASSWORD_RESET_URL := os.Getenv("PASSWORD_RESET_URL")
+	PASSWORD_MIN_LENGTH := intEnv("PASSWORD_MIN_LENGTH")
+	BREACHED_PASSWORDS_FILE := os.Getenv("BREACHED_PASSWORDS_FILE")
+	LOGIN_MAX_ATTEMPTS := intEnv("LOGIN_MAX_ATTEMPTS")
+	LOGIN_IP_MAX_ATTEMPTS := intEnv("LOGIN_IP_MAX_ATTEMPTS")
+	LOGIN_BACKOFF := durationEnv("LOGIN_BACKOFF")
+	LOGIN_LOCKOUT := durationEnv("LOGIN_LOCKOUT")
+	TRUST_PROXY_HEADERS := os.Getenv("TRUST_PROXY_HEADERS") == "true"
+	TRUSTED_PROXY_HOPS := intEnv("TRUSTED_PROXY_HOPS")
+	REQUIRE_VERIFIED_EMAIL := os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true"
+	SMTP_HOST := os.Getenv("SMTP_HOST")
+	SMTP_PORT := intEnv("SMTP_PORT")
+	SMTP_USERNAME := os.Getenv("SMTP_USERNAME")
+	SMTP_PASSWORD := os.Getenv("SMTP_PASSWORD")
+	MAIL_FROM := os.Getenv("MAIL_FROM")
+	MAIL_FILE := os.Getenv("MAIL_FILE")
+
+	if len(os.Args) > 1 {
+		err := runCommand(os.Args[1], os.Args[2:], database.Config{
+			Url:             DATABASE_URL,
+			MaxOpenConns:    DB_MAX_OPEN_CONNS,
+			MaxIdleConns:    DB_MAX_IDLE_CONNS,
+			ConnMaxLifetime: DB_CONN_MAX_LIFETIME,
+			ConnMaxIdleTime: DB_CONN_MAX_IDLE_TIME,
+			ConnectRetries:  DB_CONNECT_RETRIES,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
 	s, err := server.NewServer(context.Background(), &server.Config{
-		Port:      PORT,
-		JWTSecret: JWT_SECRET,
-		DataUrl:   DATABASE_URL,
+		Port:                  PORT,
+		JWTSecret:             JWT_SECRET,
+		JWTAlgorithm:          JWT_ALGORITHM,
+		JWTPrivateKeyFiles:    JWT_PRIVATE_KEY_FILES,
+		JWTKeyRotation:        JWT_KEY_ROTATION,
+		JWTKeyOverlap:         JWT_KEY_OVERLAP,
+		DataUrl:               DATABASE_URL,
+		PageSize:              PAGE,
+		MaxPageSize:           PAGE_MAX,
+		ReplicaUrls:           DATABASE_REPLICA_URLS,
+		ReadYourWrites:        READ_YOUR_WRITES,
+		DBMaxOpenConns:        DB_MAX_OPEN_CONNS,
+		DBMaxIdleConns:        DB_MAX_IDLE_CONNS,
+		DBConnMaxLifetime:     DB_CONN_MAX_LIFETIME,
+		DBConnMaxIdleTime:     DB_CONN_MAX_IDLE_TIME,
+		DBConnectRetries:      DB_CONNECT_RETRIES,
+		SlowQueryThreshold:    SLOW_QUERY_THRESHOLD,
+		AccessTokenTTL:        ACCESS_TOKEN_TTL,
+		RefreshTokenTTL:       REFRESH_TOKEN_TTL,
+		PublicUrl:             PUBLIC_URL,
+		VerificationSecret:    VERIFICATION_SECRET,
+		VerificationTTL:       VERIFICATION_TTL,
+		PasswordResetTTL:      PASSWORD_RESET_TTL,
+		PasswordResetUrl:      PASSWORD_RESET_URL,
+		PasswordMinLength:     PASSWORD_MIN_LENGTH,
+		BreachedPasswordsFile: BREACHED_PASSWORDS_FILE,
+		LoginMaxAttempts:      LOGIN_MAX_ATTEMPTS,
+		LoginIpMaxAttempts:    LOGIN_IP_MAX_ATTEMPTS,
+		LoginBackoff:          LOGIN_BACKOFF,
+		LoginLockout:          LOGIN_LOCKOUT,
+		TrustProxyHeaders:     TRUST_PROXY_HEADERS,
+		TrustedProxyHops:      TRUSTED_PROXY_HOPS,
+		RequireVerifiedEmail:  REQUIRE_VERIFIED_EMAIL,
+		SMTPHost:              SMTP_HOST,
+		SMTPPort:              SMTP_PORT,
+		SMTPUsername:          SMTP_USERNAME,
+		SMTPPassword:          SMTP_PASSWORD,
+		MailFrom:              MAIL_FROM,
+		MailFile:              MAIL_FILE,
 	})
 
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	s.Start(BindRoutes)
+	if err := s.Start(BindRoutes); err != nil {
+		log.Fatal(err)
+	}
 }
 
-func BindRoutes(s server.Server, r *mux.Router) {
+// intEnv: lee una variable de entorno numérica, si no existe o es inválida retorna 0
+func intEnv(key string) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Error with %s value %s, must be number\n", key, value)
+		return 0
+	}
+	return number
+}
+
+// durationEnv: lee una variable de entorno con una duración (ej: 30m), si no existe o es inválida retorna 0
+func durationEnv(key string) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Error with %s value %s, must be a duration\n", key, value)
+		return 0
+	}
+	return duration
+}
+
+// listEnv: lee una variable de entorno con valores separados por coma
+func listEnv(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// BindRoutes: registra las rutas, cada ruta debe tener su policy de autenticación,
+// el servidor no inicia si alguna ruta no tiene (middleware.CheckPolicies)
+func BindRoutes(s server.Server, r *mux.Router) error {
+	public := func(handler http.HandlerFunc) http.Handler {
+		return middleware.WithPolicy(s, middleware.PUBLIC, handler)
+	}
+	authenticated := func(handler http.HandlerFunc) http.Handler {
+		return middleware.WithPolicy(s, middleware.AUTHENTICATED, handler)
+	}
+	verified := func(handler http.HandlerFunc) http.Handler {
+		return middleware.WithPolicy(s, middleware.VERIFIED, handler)
+	}
+	requirePermission := func(permission string, handler http.HandlerFunc) http.Handler {
+		return middleware.WithPolicy(s, middleware.RequirePermission(permission), handler)
+	}
 	api := r.PathPrefix("/api/v1").Subrouter()
-	api.Use(middleware.CheckAuthMiddleware(s))
-	r.HandleFunc("/", handlers.HomeHandler(s)).Methods(http.MethodGet)
-	r.HandleFunc("/signup", handlers.SignUpHandler(s)).Methods(http.MethodPost)
-	r.HandleFunc("/login", handlers.LoginHandler(s)).Methods(http.MethodPost)
-	api.HandleFunc("/me", handlers.MeHandler(s)).Methods(http.MethodGet)
-	api.HandleFunc("/posts", handlers.InsertPostHandler(s)).Methods(http.MethodPost)
-	r.HandleFunc("/posts/{id}", handlers.GetPostByIdHandler(s)).Methods(http.MethodGet)
-	api.HandleFunc("/posts/{id}", handlers.UpdatePostHandler(s)).Methods(http.MethodPut)
-	api.HandleFunc("/posts/{id}", handlers.DeletePostHandler(s)).Methods(http.MethodDelete)
-	r.HandleFunc("/posts", handlers.ListPostHandler(s)).Methods(http.MethodGet)
-	r.HandleFunc("/ws", s.Hub().HandlerWebSocket)
+	admin := api.PathPrefix("/admin").Subrouter()
+	r.Handle("/", public(handlers.HomeHandler(s))).Methods(http.MethodGet)
+	r.Handle("/signup", public(handlers.SignUpHandler(s))).Methods(http.MethodPost)
+	r.Handle("/login", public(handlers.LoginHandler(s))).Methods(http.MethodPost)
+	r.Handle("/token/refresh", public(handlers.RefreshTokenHandler(s))).Methods(http.MethodPost)
+	r.Handle("/.well-known/jwks.json", public(handlers.JWKSHandler(s))).Methods(http.MethodGet)
+	r.Handle("/verify", public(handlers.VerifyEmailHandler(s))).Methods(http.MethodGet)
+	r.Handle("/password/forgot", public(handlers.ForgotPasswordHandler(s))).Methods(http.MethodPost)
+	r.Handle("/password/reset", public(handlers.ResetPasswordHandler(s))).Methods(http.MethodPost)
+	r.Handle("/password/reset", public(handlers.ResetPasswordFormHandler(s))).Methods(http.MethodGet)
+	api.Handle("/verify/resend", authenticated(handlers.ResendVerificationHandler(s))).Methods(http.MethodPost)
+	api.Handle("/me", authenticated(handlers.MeHandler(s))).Methods(http.MethodGet)
+	api.Handle("/me/password", authenticated(handlers.ChangePasswordHandler(s))).Methods(http.MethodPut)
+	api.Handle("/logout", authenticated(handlers.LogoutHandler(s))).Methods(http.MethodPost)
+	api.Handle("/logout/all", authenticated(handlers.LogoutAllHandler(s))).Methods(http.MethodPost)
+	api.Handle("/posts", verified(handlers.InsertPostHandler(s))).Methods(http.MethodPost)
+	r.Handle("/posts/search", public(handlers.SearchPostHandler(s))).Methods(http.MethodGet)
+	r.Handle("/posts/{id}", public(handlers.GetPostByIdHandler(s))).Methods(http.MethodGet)
+	api.Handle("/posts/{id}", verified(handlers.UpdatePostHandler(s))).Methods(http.MethodPut)
+	api.Handle("/posts/{id}", authenticated(handlers.DeletePostHandler(s))).Methods(http.MethodDelete)
+	api.Handle("/posts/{id}/restore", authenticated(handlers.RestorePostHandler(s))).Methods(http.MethodPost)
+	r.Handle("/posts/{id}/revisions", public(handlers.ListPostRevisionsHandler(s))).Methods(http.MethodGet)
+	r.Handle("/posts/{id}/revisions/diff", public(handlers.DiffPostRevisionsHandler(s))).Methods(http.MethodGet)
+	api.Handle("/posts/{id}/revisions/{revision}/revert", verified(handlers.RevertPostHandler(s))).Methods(http.MethodPost)
+	r.Handle("/posts", public(handlers.ListPostHandler(s))).Methods(http.MethodGet)
+	admin.Handle("/users", requirePermission(auth.PERMISSION_MANAGE_USERS, handlers.ListUsersHandler(s))).Methods(http.MethodGet)
+	admin.Handle("/users/{id}/disable", requirePermission(auth.PERMISSION_MANAGE_USERS, handlers.DisableUserHandler(s))).Methods(http.MethodPost)
+	admin.Handle("/users/{id}/enable", requirePermission(auth.PERMISSION_MANAGE_USERS, handlers.EnableUserHandler(s))).Methods(http.MethodPost)
+	admin.Handle("/posts/{id}", requirePermission(auth.PERMISSION_MODERATE_POSTS, handlers.ModeratePostHandler(s))).Methods(http.MethodDelete)
+	r.Handle("/ws", public(s.Hub().HandlerWebSocket))
+	r.Handle("/debug/vars", requirePermission(auth.PERMISSION_VIEW_METRICS, handlers.MetricsHandler(s))).Methods(http.MethodGet)
+	return middleware.CheckPolicies(r)
 }
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"w00k/go/rest-ws/middleware"
+	"w00k/go/rest-ws/server"
+	"w00k/go/rest-ws/websocket"
+
+	"github.com/gorilla/mux"
+)
+
+// stubServer: BindRoutes solo usa Hub al registrar las rutas, el resto de los métodos
+// se llaman dentro de los handlers y en este test no se ejecutan
+type stubServer struct {
+	server.Server
+	hub *websocket.Hub
+}
+
+func (s *stubServer) Hub() *websocket.Hub {
+	return s.hub
+}
+
+func TestBindRoutesHaveAuthPolicies(t *testing.T) {
+	s := &stubServer{hub: websocket.NewHub()}
+	if err := BindRoutes(s, mux.NewRouter()); err != nil {
+		t.Fatalf("BindRoutes() = %v, want every route with an auth policy", err)
+	}
+}
+
+func TestCheckPoliciesRejectsRouteWithoutPolicy(t *testing.T) {
+	s := &stubServer{hub: websocket.NewHub()}
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	r := mux.NewRouter()
+	r.Handle("/public", middleware.WithPolicy(s, middleware.PUBLIC, http.HandlerFunc(handler))).Methods(http.MethodGet)
+	r.HandleFunc("/unprotected", handler).Methods(http.MethodPost)
+
+	err := middleware.CheckPolicies(r)
+	if err == nil {
+		t.Fatal("CheckPolicies() = nil, want an error for the route without policy")
+	}
+	if !strings.Contains(err.Error(), "POST /unprotected") || strings.Contains(err.Error(), "/public") {
+		t.Errorf("CheckPolicies() = %q, want only POST /unprotected reported", err)
+	}
+}
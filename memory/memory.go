@@ -0,0 +1,525 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"w00k/go/rest-ws/models"
+	"w00k/go/rest-ws/repository"
+)
+
+// outboxEntry: evento del outbox con su reserva
+type outboxEntry struct {
+	event        models.OutboxEvent
+	claimedUntil time.Time
+}
+
+// data: registros guardados, cada transacción trabaja sobre una copia
+type data struct {
+	users            map[string]models.User
+	tokensValidAfter map[string]time.Time
+	posts            map[string]models.Post
+	revisions        map[string][]models.PostRevision
+	outbox           []outboxEntry
+	lastOutboxId     int64
+	refreshTokens    map[string]models.RefreshToken
+	revokedTokens    map[string]time.Time
+	resetTokens      map[string]models.PasswordResetToken
+	loginAttempts    map[string]models.LoginAttempt
+}
+
+func newData() *data {
+	return &data{
+		users:            make(map[string]models.User),
+		tokensValidAfter: make(map[string]time.Time),
+		posts:            make(map[string]models.Post),
+		revisions:        make(map[string][]models.PostRevision),
+		refreshTokens:    make(map[string]models.RefreshToken),
+		revokedTokens:    make(map[string]time.Time),
+		resetTokens:      make(map[string]models.PasswordResetToken),
+		loginAttempts:    make(map[string]models.LoginAttempt),
+	}
+}
+
+// clone: copia de los registros, los registros se guardan por valor y sus fechas opcionales
+// se reemplazan en vez de modificarse, así la copia no comparte nada que se pueda modificar
+func (d *data) clone() *data {
+	c := newData()
+	for id, user := range d.users {
+		c.users[id] = user
+	}
+	for id, after := range d.tokensValidAfter {
+		c.tokensValidAfter[id] = after
+	}
+	for id, post := range d.posts {
+		c.posts[id] = post
+	}
+	for id, revisions := range d.revisions {
+		c.revisions[id] = append([]models.PostRevision(nil), revisions...)
+	}
+	c.outbox = append([]outboxEntry(nil), d.outbox...)
+	c.lastOutboxId = d.lastOutboxId
+	for id, token := range d.refreshTokens {
+		c.refreshTokens[id] = token
+	}
+	for jti, expiresAt := range d.revokedTokens {
+		c.revokedTokens[jti] = expiresAt
+	}
+	for id, token := range d.resetTokens {
+		c.resetTokens[id] = token
+	}
+	for key, attempt := range d.loginAttempts {
+		c.loginAttempts[key] = attempt
+	}
+	return c
+}
+
+// MemoryRepository: repositorio en memoria para pruebas y desarrollo, no tiene búsqueda nativa
+// (se usa repository.SearchPosts) y se pierde al terminar el proceso
+type MemoryRepository struct {
+	mutex sync.Mutex
+	data  *data
+	// txMutex: las transacciones se ejecutan de a una
+	txMutex sync.Mutex
+	tx      bool
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{data: newData()}
+}
+
+// lock: bloquea el repositorio y retorna sus registros, se libera con repo.mutex.Unlock
+func (repo *MemoryRepository) lock() *data {
+	repo.mutex.Lock()
+	return repo.data
+}
+
+// WithTx: ejecuta fn sobre una copia de los registros que se guarda solo si fn retorna nil
+// los casos que soporta son:
+// - fn retorna nil, los cambios hechos con tx se guardan
+// - fn retorna un error o hace panic, los cambios hechos con tx se descartan y se retorna el error (o se propaga el panic)
+// - si el repositorio ya es una transacción, la llamada anidada trabaja sobre otra copia, así un error
+// solo descarta sus propios cambios y la transacción externa decide si continúa
+// las escrituras hechas fuera de la transacción mientras está en curso se pierden al guardarla,
+// como es para pruebas las transacciones se ejecutan de a una en vez de detectar conflictos
+func (repo *MemoryRepository) WithTx(ctx context.Context, fn func(tx repository.Repository) error) error {
+	if !repo.tx {
+		repo.txMutex.Lock()
+		defer repo.txMutex.Unlock()
+	}
+	d := repo.lock()
+	tx := &MemoryRepository{data: d.clone(), tx: true}
+	repo.mutex.Unlock()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	committed := tx.lock()
+	tx.mutex.Unlock()
+
+	repo.lock()
+	defer repo.mutex.Unlock()
+	repo.data = committed
+	return nil
+}
+
+func (repo *MemoryRepository) Close() error {
+	if repo.tx {
+		return fmt.Errorf("cannot close the repository inside a transaction")
+	}
+	return nil
+}
+
+// now: las fechas se guardan en UTC como en la base de datos
+func now() time.Time {
+	return time.Now().UTC()
+}
+
+func timePointer(value time.Time) *time.Time {
+	return &value
+}
+
+func (repo *MemoryRepository) InsertUser(ctx context.Context, user *models.User) error {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	if err := d.checkUniqueUser(user.Id, user.Email); err != nil {
+		return err
+	}
+	d.users[user.Id] = models.User{Id: user.Id, Email: user.Email, Password: user.Password, CreatedAt: now(), Role: "user"}
+	return nil
+}
+
+// checkUniqueUser: igual que la clave primaria y el índice users_email_lower_idx
+func (d *data) checkUniqueUser(id string, email string) error {
+	if _, ok := d.users[id]; ok {
+		return fmt.Errorf("duplicate user id %s", id)
+	}
+	for _, user := range d.users {
+		if strings.EqualFold(user.Email, email) {
+			return fmt.Errorf("duplicate key value violates unique constraint \"users_email_lower_idx\"")
+		}
+	}
+	return nil
+}
+
+// GetUserById: si el usuario no existe retorna un usuario vacío, como PostgresRepository,
+// no incluye el hash de la contraseña
+func (repo *MemoryRepository) GetUserById(ctx context.Context, id string) (*models.User, error) {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	user := d.users[id]
+	user.Password = ""
+	return &user, nil
+}
+
+// GetUserByEmail: busca el correo sin importar mayúsculas, si no existe retorna un usuario vacío
+func (repo *MemoryRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	for _, user := range d.users {
+		if strings.EqualFold(user.Email, email) {
+			return &user, nil
+		}
+	}
+	return &models.User{}, nil
+}
+
+// updateUser: aplica update al usuario, retorna repository.ErrNotFound si no existe
+func (repo *MemoryRepository) updateUser(userId string, update func(user *models.User) error) error {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	user, ok := d.users[userId]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	if err := update(&user); err != nil {
+		return err
+	}
+	d.users[userId] = user
+	return nil
+}
+
+func (repo *MemoryRepository) SetUserRole(ctx context.Context, userId string, role string) error {
+	return repo.updateUser(userId, func(user *models.User) error {
+		user.Role = role
+		return nil
+	})
+}
+
+func (repo *MemoryRepository) SetUserDisabled(ctx context.Context, userId string, disabled bool) error {
+	return repo.updateUser(userId, func(user *models.User) error {
+		if !disabled {
+			user.DisabledAt = nil
+		} else if user.DisabledAt == nil {
+			user.DisabledAt = timePointer(now())
+		}
+		return nil
+	})
+}
+
+func (repo *MemoryRepository) MarkEmailVerified(ctx context.Context, userId string, email string) error {
+	return repo.updateUser(userId, func(user *models.User) error {
+		if user.Email != email {
+			return repository.ErrNotFound
+		}
+		if user.EmailVerifiedAt == nil {
+			user.EmailVerifiedAt = timePointer(now())
+		}
+		return nil
+	})
+}
+
+func (repo *MemoryRepository) UpdateUserPassword(ctx context.Context, userId string, password string) error {
+	return repo.updateUser(userId, func(user *models.User) error {
+		user.Password = password
+		return nil
+	})
+}
+
+func (repo *MemoryRepository) InsertPost(ctx context.Context, post *models.Post) error {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	if _, ok := d.posts[post.Id]; ok {
+		return fmt.Errorf("duplicate post id %s", post.Id)
+	}
+	post.CreateAt = now()
+	post.Version = 1
+	d.posts[post.Id] = models.Post{Id: post.Id, PostContent: post.PostContent, UserId: post.UserId, CreateAt: post.CreateAt, Version: post.Version}
+	return nil
+}
+
+// GetPostById: los posts borrados no se consideran, si no existe retorna repository.ErrNotFound
+func (repo *MemoryRepository) GetPostById(ctx context.Context, id string) (*models.Post, error) {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	post, ok := d.posts[id]
+	if !ok || post.DeletedAt != nil {
+		return nil, repository.ErrNotFound
+	}
+	return &post, nil
+}
+
+// UpdatePost: mismos casos que PostgresRepository.UpdatePost
+func (repo *MemoryRepository) UpdatePost(ctx context.Context, post *models.Post) error {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	stored, ok := d.posts[post.Id]
+	switch {
+	case !ok || stored.DeletedAt != nil:
+		return repository.ErrNotFound
+	case stored.UserId != post.UserId:
+		return repository.ErrForbidden
+	case post.Version != 0 && stored.Version != post.Version:
+		return repository.ErrVersionMismatch
+	}
+	stored.PostContent = post.PostContent
+	stored.Version++
+	d.posts[post.Id] = stored
+	post.Version = stored.Version
+	return nil
+}
+
+// DeletePost: mismos casos que PostgresRepository.DeletePost
+func (repo *MemoryRepository) DeletePost(ctx context.Context, id string, userId string) error {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	post, ok := d.posts[id]
+	switch {
+	case !ok || post.DeletedAt != nil:
+		return repository.ErrNotFound
+	case post.UserId != userId:
+		return repository.ErrForbidden
+	}
+	post.DeletedAt = timePointer(now())
+	d.posts[id] = post
+	return nil
+}
+
+// ForceDeletePost: mismos casos que PostgresRepository.ForceDeletePost
+func (repo *MemoryRepository) ForceDeletePost(ctx context.Context, id string) error {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	post, ok := d.posts[id]
+	if !ok || post.ModeratedAt != nil {
+		return repository.ErrNotFound
+	}
+	moderatedAt := now()
+	if post.DeletedAt == nil {
+		post.DeletedAt = &moderatedAt
+	}
+	post.ModeratedAt = &moderatedAt
+	d.posts[id] = post
+	return nil
+}
+
+// RestorePost: mismos casos que PostgresRepository.RestorePost
+func (repo *MemoryRepository) RestorePost(ctx context.Context, id string, userId string, deletedAfter time.Time) error {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	post, ok := d.posts[id]
+	switch {
+	case !ok:
+		return repository.ErrNotFound
+	case post.UserId != userId || post.ModeratedAt != nil:
+		return repository.ErrForbidden
+	case post.DeletedAt == nil:
+		return repository.ErrNotDeleted
+	case post.DeletedAt.Before(deletedAfter):
+		return repository.ErrRestoreExpired
+	}
+	post.DeletedAt = nil
+	d.posts[id] = post
+	return nil
+}
+
+// PurgeDeletedPosts: elimina los posts borrados antes de before junto con sus revisiones
+func (repo *MemoryRepository) PurgeDeletedPosts(ctx context.Context, before time.Time) (int64, error) {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	var purged int64
+	for id, post := range d.posts {
+		if post.DeletedAt != nil && post.DeletedAt.Before(before) {
+			delete(d.posts, id)
+			delete(d.revisions, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// ListPost: mismo orden y filtros que PostgresRepository.ListPost
+func (repo *MemoryRepository) ListPost(ctx context.Context, options repository.ListPostOptions) ([]*models.Post, error) {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	newest := options.Sort == repository.SortNewest
+	//before: el post (createdAt, id) va antes que (otherCreatedAt, otherId) en orden ascendente
+	before := func(createdAt time.Time, id string, otherCreatedAt time.Time, otherId string) bool {
+		if !createdAt.Equal(otherCreatedAt) {
+			return createdAt.Before(otherCreatedAt)
+		}
+		return id < otherId
+	}
+	var posts []*models.Post
+	for _, post := range d.posts {
+		post := post
+		switch {
+		case post.DeletedAt != nil:
+		case options.UserId != "" && post.UserId != options.UserId:
+		case options.Since != nil && post.CreateAt.Before(*options.Since):
+		case options.Until != nil && post.CreateAt.After(*options.Until):
+		case options.After != nil && !newest && !before(options.After.CreatedAt, options.After.Id, post.CreateAt, post.Id):
+		case options.After != nil && newest && !before(post.CreateAt, post.Id, options.After.CreatedAt, options.After.Id):
+		default:
+			posts = append(posts, &post)
+		}
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		if newest {
+			i, j = j, i
+		}
+		return before(posts[i].CreateAt, posts[i].Id, posts[j].CreateAt, posts[j].Id)
+	})
+	if options.After == nil {
+		offset := options.Page * uint64(options.Limit)
+		if offset >= uint64(len(posts)) {
+			return nil, nil
+		}
+		posts = posts[offset:]
+	}
+	if len(posts) > options.Limit {
+		posts = posts[:options.Limit]
+	}
+	return posts, nil
+}
+
+// InsertPostRevision: guarda la revisión con el número siguiente a la última y asigna el número y la fecha
+func (repo *MemoryRepository) InsertPostRevision(ctx context.Context, revision *models.PostRevision) error {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	revisions := d.revisions[revision.PostId]
+	revision.Revision = 1
+	if len(revisions) > 0 {
+		revision.Revision = revisions[len(revisions)-1].Revision + 1
+	}
+	revision.CreatedAt = now()
+	d.revisions[revision.PostId] = append(revisions, *revision)
+	return nil
+}
+
+func (repo *MemoryRepository) ListPostRevisions(ctx context.Context, postId string) ([]*models.PostRevision, error) {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	var revisions []*models.PostRevision
+	for _, revision := range d.revisions[postId] {
+		revision := revision
+		revisions = append(revisions, &revision)
+	}
+	return revisions, nil
+}
+
+// GetPostRevision: si la revisión no existe retorna repository.ErrNotFound
+func (repo *MemoryRepository) GetPostRevision(ctx context.Context, postId string, number int) (*models.PostRevision, error) {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	for _, revision := range d.revisions[postId] {
+		if revision.Revision == number {
+			return &revision, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (repo *MemoryRepository) ScanUsers(ctx context.Context, after string, limit int) ([]*models.User, error) {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	var users []*models.User
+	for _, id := range sortedKeys(d.users) {
+		if id > after && len(users) < limit {
+			user := d.users[id]
+			users = append(users, &user)
+		}
+	}
+	return users, nil
+}
+
+func (repo *MemoryRepository) ScanPosts(ctx context.Context, after string, limit int) ([]*models.Post, error) {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	var posts []*models.Post
+	for _, id := range sortedKeys(d.posts) {
+		if id > after && len(posts) < limit {
+			post := d.posts[id]
+			posts = append(posts, &post)
+		}
+	}
+	return posts, nil
+}
+
+func (repo *MemoryRepository) ScanPostRevisions(ctx context.Context, afterPostId string, afterRevision int, limit int) ([]*models.PostRevision, error) {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	var revisions []*models.PostRevision
+	for _, postId := range sortedKeys(d.revisions) {
+		for _, revision := range d.revisions[postId] {
+			if (postId > afterPostId || (postId == afterPostId && revision.Revision > afterRevision)) && len(revisions) < limit {
+				revision := revision
+				revisions = append(revisions, &revision)
+			}
+		}
+	}
+	return revisions, nil
+}
+
+// UpsertUser: el correo se normaliza como en PostgresRepository.UpsertUser
+func (repo *MemoryRepository) UpsertUser(ctx context.Context, user *models.User) error {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	stored := *user
+	stored.Email = strings.ToLower(strings.TrimSpace(user.Email))
+	stored.CreatedAt = user.CreatedAt.UTC()
+	if stored.Role == "" {
+		stored.Role = "user"
+	}
+	d.users[user.Id] = stored
+	return nil
+}
+
+func (repo *MemoryRepository) UpsertPost(ctx context.Context, post *models.Post) error {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	stored := *post
+	stored.CreateAt = post.CreateAt.UTC()
+	d.posts[post.Id] = stored
+	return nil
+}
+
+func (repo *MemoryRepository) UpsertPostRevision(ctx context.Context, revision *models.PostRevision) error {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	stored := *revision
+	stored.CreatedAt = revision.CreatedAt.UTC()
+	revisions := d.revisions[revision.PostId]
+	for i := range revisions {
+		if revisions[i].Revision == revision.Revision {
+			revisions[i] = stored
+			return nil
+		}
+	}
+	revisions = append(revisions, stored)
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].Revision < revisions[j].Revision })
+	d.revisions[revision.PostId] = revisions
+	return nil
+}
+
+// sortedKeys: claves del mapa ordenadas, para recorrerlo en el mismo orden que la base de datos
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,156 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"w00k/go/rest-ws/models"
+	"w00k/go/rest-ws/repository"
+)
+
+var errTest = errors.New("test error")
+
+func insertPost(ctx context.Context, tx repository.Repository, id string) error {
+	return tx.InsertPost(ctx, &models.Post{Id: id, PostContent: id, UserId: "user"})
+}
+
+func TestWithTx(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(ctx context.Context, tx repository.Repository) error
+		err  error
+		want []string
+	}{
+		{
+			name: "commit",
+			fn: func(ctx context.Context, tx repository.Repository) error {
+				return insertPost(ctx, tx, "a")
+			},
+			want: []string{"a"},
+		},
+		{
+			name: "rollback on error",
+			fn: func(ctx context.Context, tx repository.Repository) error {
+				if err := insertPost(ctx, tx, "a"); err != nil {
+					return err
+				}
+				return errTest
+			},
+			err: errTest,
+		},
+		{
+			name: "nested rollback keeps outer changes",
+			fn: func(ctx context.Context, tx repository.Repository) error {
+				if err := insertPost(ctx, tx, "a"); err != nil {
+					return err
+				}
+				err := tx.WithTx(ctx, func(nested repository.Repository) error {
+					if err := insertPost(ctx, nested, "b"); err != nil {
+						return err
+					}
+					return errTest
+				})
+				if !errors.Is(err, errTest) {
+					return err
+				}
+				return insertPost(ctx, tx, "c")
+			},
+			want: []string{"a", "c"},
+		},
+		{
+			name: "nested commit is visible to the outer transaction",
+			fn: func(ctx context.Context, tx repository.Repository) error {
+				err := tx.WithTx(ctx, func(nested repository.Repository) error {
+					return insertPost(ctx, nested, "a")
+				})
+				if err != nil {
+					return err
+				}
+				if _, err := tx.GetPostById(ctx, "a"); err != nil {
+					return err
+				}
+				return insertPost(ctx, tx, "b")
+			},
+			want: []string{"a", "b"},
+		},
+		{
+			name: "outer rollback discards nested commit",
+			fn: func(ctx context.Context, tx repository.Repository) error {
+				err := tx.WithTx(ctx, func(nested repository.Repository) error {
+					return insertPost(ctx, nested, "a")
+				})
+				if err != nil {
+					return err
+				}
+				return errTest
+			},
+			err: errTest,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := NewMemoryRepository()
+			err := repo.WithTx(ctx, func(tx repository.Repository) error {
+				return test.fn(ctx, tx)
+			})
+			if !errors.Is(err, test.err) {
+				t.Fatalf("WithTx() = %v, want %v", err, test.err)
+			}
+			posts, err := repo.ScanPosts(ctx, "", 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, post := range posts {
+				ids = append(ids, post.Id)
+			}
+			if len(ids) != len(test.want) {
+				t.Fatalf("posts = %v, want %v", ids, test.want)
+			}
+			for i := range ids {
+				if ids[i] != test.want[i] {
+					t.Errorf("posts = %v, want %v", ids, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestWithTxRollsBackOnPanic(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepository()
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("WithTx() did not propagate the panic")
+			}
+		}()
+		repo.WithTx(ctx, func(tx repository.Repository) error {
+			insertPost(ctx, tx, "a")
+			panic("test panic")
+		})
+	}()
+	if _, err := repo.GetPostById(ctx, "a"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("GetPostById() = %v, want ErrNotFound after the panic", err)
+	}
+	//el mutex de las transacciones se liberó
+	if err := repo.WithTx(ctx, func(tx repository.Repository) error { return nil }); err != nil {
+		t.Errorf("WithTx() after panic = %v", err)
+	}
+}
+
+func TestWithTxIsolatesUncommittedChanges(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepository()
+	repo.WithTx(ctx, func(tx repository.Repository) error {
+		insertPost(ctx, tx, "a")
+		if _, err := repo.GetPostById(ctx, "a"); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("GetPostById() outside the transaction = %v, want ErrNotFound before commit", err)
+		}
+		return nil
+	})
+	if _, err := repo.GetPostById(ctx, "a"); err != nil {
+		t.Errorf("GetPostById() after commit = %v", err)
+	}
+}
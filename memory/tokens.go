@@ -0,0 +1,267 @@
+package memory
+
+import (
+	"context"
+	"math"
+	"time"
+	"w00k/go/rest-ws/models"
+	"w00k/go/rest-ws/repository"
+)
+
+// MAX_BACKOFF_EXPONENT: límite del exponente del backoff, igual que en la base de datos
+const MAX_BACKOFF_EXPONENT = 60
+
+func (repo *MemoryRepository) InsertOutboxEvent(ctx context.Context, event *models.OutboxEvent) error {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	d.lastOutboxId++
+	event.Id = d.lastOutboxId
+	event.CreatedAt = now()
+	d.outbox = append(d.outbox, outboxEntry{event: *event})
+	return nil
+}
+
+// ClaimOutboxEvents: toma hasta limit eventos no entregados ni reservados, en orden de inserción
+func (repo *MemoryRepository) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxEvent, error) {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	claimedAt := now()
+	var events []*models.OutboxEvent
+	for i := range d.outbox {
+		entry := &d.outbox[i]
+		if len(events) < limit && entry.event.DeliveredAt == nil && entry.claimedUntil.Before(claimedAt) {
+			entry.claimedUntil = claimedAt.Add(lease)
+			event := entry.event
+			events = append(events, &event)
+		}
+	}
+	return events, nil
+}
+
+func (repo *MemoryRepository) MarkOutboxEventsDelivered(ctx context.Context, ids []int64) error {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	deliveredAt := now()
+	for _, id := range ids {
+		for i := range d.outbox {
+			if d.outbox[i].event.Id == id {
+				d.outbox[i].event.DeliveredAt = &deliveredAt
+			}
+		}
+	}
+	return nil
+}
+
+func (repo *MemoryRepository) DeleteDeliveredOutboxEvents(ctx context.Context, before time.Time) (int64, error) {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	var kept []outboxEntry
+	for _, entry := range d.outbox {
+		if entry.event.DeliveredAt == nil || !entry.event.DeliveredAt.Before(before) {
+			kept = append(kept, entry)
+		}
+	}
+	deleted := int64(len(d.outbox) - len(kept))
+	d.outbox = kept
+	return deleted, nil
+}
+
+func (repo *MemoryRepository) InsertRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	token.CreatedAt = now()
+	d.refreshTokens[token.Id] = *token
+	return nil
+}
+
+// GetRefreshToken: si no existe un token con ese hash retorna repository.ErrNotFound
+func (repo *MemoryRepository) GetRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	for _, token := range d.refreshTokens {
+		if token.TokenHash == tokenHash {
+			return &token, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+// UseRefreshToken: si el token no existe, ya se usó o fue revocado retorna repository.ErrTokenUsed
+func (repo *MemoryRepository) UseRefreshToken(ctx context.Context, id string) error {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	token, ok := d.refreshTokens[id]
+	if !ok || token.UsedAt != nil || token.RevokedAt != nil {
+		return repository.ErrTokenUsed
+	}
+	token.UsedAt = timePointer(now())
+	d.refreshTokens[id] = token
+	return nil
+}
+
+func (repo *MemoryRepository) RevokeRefreshTokenFamily(ctx context.Context, familyId string) error {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	d.revokeRefreshTokens(func(token models.RefreshToken) bool { return token.FamilyId == familyId })
+	return nil
+}
+
+// revokeRefreshTokens: revoca los refresh tokens no revocados que cumplen match
+func (d *data) revokeRefreshTokens(match func(token models.RefreshToken) bool) {
+	revokedAt := now()
+	for id, token := range d.refreshTokens {
+		if token.RevokedAt == nil && match(token) {
+			token.RevokedAt = &revokedAt
+			d.refreshTokens[id] = token
+		}
+	}
+}
+
+func (repo *MemoryRepository) RevokeToken(ctx context.Context, jti string, userId string, expiresAt time.Time) error {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	if _, ok := d.revokedTokens[jti]; !ok {
+		d.revokedTokens[jti] = expiresAt
+	}
+	return nil
+}
+
+// RevokeUserTokens: mismos casos que PostgresRepository.RevokeUserTokens
+func (repo *MemoryRepository) RevokeUserTokens(ctx context.Context, userId string, before time.Time) error {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	if _, ok := d.users[userId]; !ok {
+		return repository.ErrNotFound
+	}
+	d.tokensValidAfter[userId] = before.UTC().Truncate(time.Second)
+	d.revokeRefreshTokens(func(token models.RefreshToken) bool { return token.UserId == userId })
+	return nil
+}
+
+func (repo *MemoryRepository) IsTokenRevoked(ctx context.Context, jti string, userId string, issuedAt time.Time) (bool, error) {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	if _, ok := d.revokedTokens[jti]; ok {
+		return true, nil
+	}
+	validAfter, ok := d.tokensValidAfter[userId]
+	return ok && validAfter.After(issuedAt), nil
+}
+
+func (repo *MemoryRepository) InsertPasswordResetToken(ctx context.Context, token *models.PasswordResetToken) error {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	token.CreatedAt = now()
+	d.resetTokens[token.Id] = *token
+	return nil
+}
+
+// UsePasswordResetToken: mismos casos que PostgresRepository.UsePasswordResetToken
+func (repo *MemoryRepository) UsePasswordResetToken(ctx context.Context, tokenHash string) (*models.PasswordResetToken, error) {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	usedAt := now()
+	for _, token := range d.resetTokens {
+		if token.TokenHash != tokenHash || token.UsedAt != nil || !token.ExpiresAt.After(usedAt) {
+			continue
+		}
+		for id, pending := range d.resetTokens {
+			if pending.UserId == token.UserId && pending.UsedAt == nil {
+				pending.UsedAt = &usedAt
+				d.resetTokens[id] = pending
+			}
+		}
+		token.UsedAt = &usedAt
+		return &token, nil
+	}
+	return nil, repository.ErrNotFound
+}
+
+// PurgeExpiredTokens: elimina los refresh tokens, los tokens para restablecer la contraseña
+// y las revocaciones que expiraron antes de before
+func (repo *MemoryRepository) PurgeExpiredTokens(ctx context.Context, before time.Time) (int64, error) {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	var purged int64
+	for id, token := range d.refreshTokens {
+		if token.ExpiresAt.Before(before) {
+			delete(d.refreshTokens, id)
+			purged++
+		}
+	}
+	for jti, expiresAt := range d.revokedTokens {
+		if expiresAt.Before(before) {
+			delete(d.revokedTokens, jti)
+			purged++
+		}
+	}
+	for id, token := range d.resetTokens {
+		if token.ExpiresAt.Before(before) {
+			delete(d.resetTokens, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// ReserveLoginAttempt: mismos casos que PostgresRepository.ReserveLoginAttempt
+func (repo *MemoryRepository) ReserveLoginAttempt(ctx context.Context, key string, limit repository.LoginLimit) (*models.LoginAttempt, error) {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	failedAt := now()
+	attempt, ok := d.loginAttempts[key]
+	if !ok {
+		attempt = models.LoginAttempt{Key: key, Failures: 1, LastFailureAt: failedAt}
+		d.loginAttempts[key] = attempt
+		return &attempt, nil
+	}
+	if attempt.LockedUntil != nil && attempt.LockedUntil.After(failedAt) {
+		return &attempt, repository.ErrLoginLocked
+	}
+	if attempt.LastFailureAt.Before(failedAt.Add(-limit.Lockout)) {
+		attempt.Failures = 1
+	} else {
+		attempt.Failures++
+	}
+	attempt.LastFailureAt = failedAt
+	attempt.LockedUntil = nil
+	if attempt.Failures > limit.MaxAttempts {
+		exponent := math.Min(float64(attempt.Failures-limit.MaxAttempts-1), MAX_BACKOFF_EXPONENT)
+		seconds := math.Min(limit.Backoff.Seconds()*math.Pow(2, exponent), limit.Lockout.Seconds())
+		attempt.LockedUntil = timePointer(failedAt.Add(time.Duration(seconds * float64(time.Second))))
+	}
+	d.loginAttempts[key] = attempt
+	return &attempt, nil
+}
+
+func (repo *MemoryRepository) ReleaseLoginAttempt(ctx context.Context, key string) error {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	if attempt, ok := d.loginAttempts[key]; ok && attempt.Failures > 0 {
+		attempt.Failures--
+		d.loginAttempts[key] = attempt
+	}
+	return nil
+}
+
+func (repo *MemoryRepository) ResetLoginAttempts(ctx context.Context, key string) error {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	delete(d.loginAttempts, key)
+	return nil
+}
+
+// PurgeLoginAttempts: elimina los intentos no bloqueados cuyo último fallo fue antes de before
+func (repo *MemoryRepository) PurgeLoginAttempts(ctx context.Context, before time.Time) (int64, error) {
+	d := repo.lock()
+	defer repo.mutex.Unlock()
+	purgedAt := now()
+	var purged int64
+	for key, attempt := range d.loginAttempts {
+		if attempt.LastFailureAt.Before(before) && (attempt.LockedUntil == nil || attempt.LockedUntil.Before(purgedAt)) {
+			delete(d.loginAttempts, key)
+			purged++
+		}
+	}
+	return purged, nil
+}
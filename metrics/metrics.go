@@ -0,0 +1,148 @@
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var publishMutex sync.Mutex
+
+// Counter: contador seguro para usar desde varias goroutines
+type Counter struct {
+	value int64
+}
+
+func (c *Counter) Inc() {
+	atomic.AddInt64(&c.value, 1)
+}
+
+func (c *Counter) Value() int64 {
+	return atomic.LoadInt64(&c.value)
+}
+
+// String: implementa expvar.Var
+func (c *Counter) String() string {
+	return strconv.FormatInt(c.Value(), 10)
+}
+
+// Publish: publica una métrica global del proceso (por ejemplo la auditoría), si ya existe una
+// métrica con ese nombre se mantiene la primera (expvar no permite reemplazarlas); las métricas
+// de cada servidor se publican en su Registry
+func Publish(name string, v expvar.Var) {
+	publishMutex.Lock()
+	defer publishMutex.Unlock()
+
+	if expvar.Get(name) != nil {
+		return
+	}
+	expvar.Publish(name, v)
+}
+
+// Registry: métricas de un servidor, cada servidor del proceso tiene el suyo y así varios
+// servidores pueden publicar métricas con el mismo nombre sin pisarse
+type Registry struct {
+	mutex sync.RWMutex
+	vars  map[string]expvar.Var
+}
+
+func NewRegistry() *Registry {
+	return &Registry{vars: make(map[string]expvar.Var)}
+}
+
+// Set: agrega la métrica al registro, si ya existe una con ese nombre la reemplaza
+func (registry *Registry) Set(name string, v expvar.Var) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	registry.vars[name] = v
+}
+
+// ServeHTTP: responde en formato JSON las métricas globales y las del registro,
+// si un nombre está en los dos se responde la del registro
+func (registry *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	values := make(map[string]string)
+	expvar.Do(func(kv expvar.KeyValue) {
+		values[kv.Key] = kv.Value.String()
+	})
+	registry.mutex.RLock()
+	for name, v := range registry.vars {
+		values[name] = v.String()
+	}
+	registry.mutex.RUnlock()
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write([]byte("{\n"))
+	for i, name := range names {
+		if i > 0 {
+			w.Write([]byte(",\n"))
+		}
+		key, _ := json.Marshal(name)
+		w.Write(key)
+		w.Write([]byte(": "))
+		w.Write([]byte(values[name]))
+	}
+	w.Write([]byte("\n}\n"))
+}
+
+// límites de los buckets de los histogramas de latencia, en milisegundos
+var latencyBuckets = []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000}
+
+// Histogram: histograma de latencias con buckets fijos en milisegundos
+type Histogram struct {
+	mutex  sync.Mutex
+	counts [12]int64 //un bucket por límite más el bucket +Inf
+	count  int64
+	sum    float64
+}
+
+func (h *Histogram) Observe(duration time.Duration) {
+	ms := float64(duration) / float64(time.Millisecond)
+	i := sort.SearchFloat64s(latencyBuckets, ms)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.counts[i]++
+	h.count++
+	h.sum += ms
+}
+
+// Snapshot: cantidad de observaciones por bucket ("le" en ms, acumulado), total y suma en ms
+func (h *Histogram) Snapshot() map[string]interface{} {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	buckets := make(map[string]int64, len(h.counts))
+	cumulative := int64(0)
+	for i, count := range h.counts {
+		cumulative += count
+		le := "+Inf"
+		if i < len(latencyBuckets) {
+			le = strconv.FormatFloat(latencyBuckets[i], 'f', -1, 64)
+		}
+		buckets[le] = cumulative
+	}
+	return map[string]interface{}{
+		"buckets": buckets,
+		"count":   h.count,
+		"sum_ms":  h.sum,
+	}
+}
+
+// String: implementa expvar.Var
+func (h *Histogram) String() string {
+	data, _ := json.Marshal(h.Snapshot())
+	return string(data)
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func serveRegistry(t *testing.T, registry *Registry) map[string]json.RawMessage {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	registry.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(recorder.Body.Bytes(), &values); err != nil {
+		t.Fatalf("response is not JSON: %v\n%s", err, recorder.Body.String())
+	}
+	return values
+}
+
+func TestRegistriesDoNotShareMetrics(t *testing.T) {
+	first, second := NewRegistry(), NewRegistry()
+	var firstCounter, secondCounter Counter
+	firstCounter.Inc()
+	first.Set("requests", &firstCounter)
+	second.Set("requests", &secondCounter)
+
+	tests := []struct {
+		name     string
+		registry *Registry
+		want     string
+	}{
+		{"first", first, "1"},
+		{"second", second, "0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values := serveRegistry(t, test.registry)
+			if got := string(values["requests"]); got != test.want {
+				t.Errorf("requests = %s, want %s", got, test.want)
+			}
+			if _, ok := values["memstats"]; !ok {
+				t.Error("global expvar metrics missing from the response")
+			}
+		})
+	}
+}
+
+func TestRegistrySetReplaces(t *testing.T) {
+	registry := NewRegistry()
+	registry.Set("value", expvar.Func(func() interface{} { return "old" }))
+	registry.Set("value", expvar.Func(func() interface{} { return "new" }))
+	if got := string(serveRegistry(t, registry)["value"]); got != `"new"` {
+		t.Errorf("value = %s, want \"new\"", got)
+	}
+}
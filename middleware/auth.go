@@ -1,54 +1,159 @@
 package middleware
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
+	"time"
+	"w00k/go/rest-ws/auth"
 	"w00k/go/rest-ws/models"
 	"w00k/go/rest-ws/server"
 
 	"github.com/golang-jwt/jwt"
+	"github.com/gorilla/mux"
 )
 
-// rutas a no validar
+// Policy: quién puede acceder a una ruta, se asigna a cada ruta al registrarla en BindRoutes
+type Policy struct {
+	Name          string
+	Authenticated bool     // requiere un token válido
+	Roles         []string // si no está vacío, el usuario debe tener alguno de estos roles
+	Permission    string   // si no está vacío, el rol del usuario debe tener este permiso
+	// VerifiedEmail: con Config.RequireVerifiedEmail el usuario debe haber verificado su correo
+	VerifiedEmail bool
+}
+
 var (
-	NO_AUTH_NEEDED = []string{
-		"login",
-		"signup",
-	}
+	// PUBLIC: la ruta no requiere token
+	PUBLIC = Policy{Name: "public"}
+	// AUTHENTICATED: la ruta requiere un token válido y no revocado
+	AUTHENTICATED = Policy{Name: "authenticated", Authenticated: true}
+	// VERIFIED: como AUTHENTICATED, pero si Config.RequireVerifiedEmail está activo
+	// el usuario además debe haber verificado su correo (por ejemplo para publicar)
+	VERIFIED = Policy{Name: "verified", Authenticated: true, VerifiedEmail: true}
 )
 
-// shouldCheckToken: rutas que validan tokens
-func shouldCheckToken(route string) bool {
-	for _, p := range NO_AUTH_NEEDED {
-		if strings.Contains(route, p) {
-			return false
+// RequireRole: la ruta requiere un token válido de un usuario con alguno de los roles
+func RequireRole(roles ...string) Policy {
+	return Policy{Name: "role:" + strings.Join(roles, ","), Authenticated: true, Roles: roles}
+}
+
+// RequirePermission: la ruta requiere un token válido de un usuario cuyo rol tenga el permiso
+func RequirePermission(permission string) Policy {
+	return Policy{Name: "permission:" + permission, Authenticated: true, Permission: permission}
+}
+
+func (policy Policy) allows(claims *models.AppClaims) bool {
+	if policy.Permission != "" && !auth.HasPermission(claims.Role, policy.Permission) {
+		return false
+	}
+	if len(policy.Roles) == 0 {
+		return true
+	}
+	for _, role := range policy.Roles {
+		if claims.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// policyHandler: handler con su policy, CheckPolicies lo usa para verificar que todas las rutas tengan una
+type policyHandler struct {
+	server  server.Server
+	policy  Policy
+	handler http.Handler
+}
+
+// WithPolicy: aplica la policy al handler, con las policies autenticadas los handlers
+// obtienen los claims del token con auth.ClaimsFrom
+// los casos son:
+// - si el token no existe, es inválido o está revocado, se retorna un response de error con HTTP 401
+// - si el usuario no tiene el rol o el permiso requerido, se retorna un response de error con HTTP 403
+// - si la policy requiere el correo verificado y el usuario no lo verificó, se retorna un response de error con HTTP 403
+func WithPolicy(s server.Server, policy Policy, handler http.Handler) http.Handler {
+	return &policyHandler{server: s, policy: policy, handler: handler}
+}
+
+func (h *policyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	//ruta no protegida
+	if !h.policy.Authenticated {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+	claims, status, err := authenticate(h.server, r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if !h.policy.allows(claims) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if h.policy.VerifiedEmail && h.server.Config().RequireVerifiedEmail {
+		//la verificación no va en el token para que aplique apenas el usuario abre el link
+		user, err := h.server.Repository().GetUserById(r.Context(), claims.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if user.EmailVerifiedAt == nil {
+			http.Error(w, "Email not verified", http.StatusForbidden)
+			return
+		}
+	}
+	//en caso que todo este OK, los handlers obtienen los claims con auth.ClaimsFrom
+	h.handler.ServeHTTP(w, r.WithContext(auth.WithClaims(r.Context(), claims)))
+}
+
+// authenticate: valida el token del header Authorization y que no esté revocado
+func authenticate(s server.Server, r *http.Request) (*models.AppClaims, int, error) {
+	//obtenemos el token
+	tokenString := auth.TokenFromHeader(r.Header.Get("Authorization"))
+	//validamos con el error
+	token, err := jwt.ParseWithClaims(tokenString, &models.AppClaims{}, s.Keys().Keyfunc)
+	//si el error es distinto que nil, retornamos no autorizado
+	if err != nil {
+		return nil, http.StatusUnauthorized, err
+	}
+	claims, ok := token.Claims.(*models.AppClaims)
+	if !ok || !token.Valid {
+		return nil, http.StatusUnauthorized, errors.New("Invalid token")
+	}
+	//el token puede haberse revocado con logout o con un cambio de contraseña
+	revoked, err := s.Repository().IsTokenRevoked(r.Context(), claims.Id, claims.UserId, time.Unix(claims.IssuedAt, 0))
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if revoked {
+		return nil, http.StatusUnauthorized, errors.New("Token revoked")
+	}
+	return claims, http.StatusOK, nil
+}
+
+// CheckPolicies: retorna un error si alguna ruta del router no tiene policy,
+// se llama al iniciar el servidor para que una ruta nueva no quede expuesta por olvido
+func CheckPolicies(router *mux.Router) error {
+	var missing []string
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		handler := route.GetHandler()
+		if handler == nil {
+			//prefijos de subrouters, no atienden requests
+			return nil
+		}
+		if _, ok := handler.(*policyHandler); !ok {
+			path, _ := route.GetPathTemplate()
+			methods, _ := route.GetMethods()
+			missing = append(missing, strings.TrimSpace(strings.Join(methods, ",")+" "+path))
 		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
-	return true
-}
-
-// CheckAuthMiddleware: validador de tokens
-func CheckAuthMiddleware(s server.Server) func(h http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			//ruta no protegida
-			if !shouldCheckToken(r.URL.Path) {
-				next.ServeHTTP(w, r)
-				return
-			}
-			//obtenemos el token
-			tokenString := strings.TrimSpace(r.Header.Get("Authorization"))
-			//validamos con el error
-			_, err := jwt.ParseWithClaims(tokenString, &models.AppClaims{}, func(token *jwt.Token) (interface{}, error) {
-				return []byte(s.Config().JWTSecret), nil
-			})
-			//si el error es distinto que nil, retornamos no autorizado
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusUnauthorized)
-				return
-			}
-			//en caso que todo este OK
-			next.ServeHTTP(w, r)
-		})
+	if len(missing) > 0 {
+		return fmt.Errorf("routes without auth policy: %s", strings.Join(missing, "; "))
 	}
+	return nil
 }
@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"w00k/go/rest-ws/auth"
+	"w00k/go/rest-ws/models"
+
+	"github.com/gorilla/mux"
+)
+
+func TestPolicyAllows(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		role   string
+		want   bool
+	}{
+		{"user without permission", RequirePermission(auth.PERMISSION_MANAGE_USERS), auth.ROLE_USER, false},
+		{"admin with permission", RequirePermission(auth.PERMISSION_MANAGE_USERS), auth.ROLE_ADMIN, true},
+		{"unknown role", RequirePermission(auth.PERMISSION_MANAGE_USERS), "superuser", false},
+		{"empty role", RequirePermission(auth.PERMISSION_MANAGE_USERS), "", false},
+		{"role listed", RequireRole(auth.ROLE_ADMIN), auth.ROLE_ADMIN, true},
+		{"role not listed", RequireRole(auth.ROLE_ADMIN), auth.ROLE_USER, false},
+		{"authenticated user", AUTHENTICATED, auth.ROLE_USER, true},
+		{"authenticated unknown role", AUTHENTICATED, "superuser", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.policy.allows(&models.AppClaims{Role: test.role}); got != test.want {
+				t.Errorf("%s.allows(%q) = %v, want %v", test.policy.Name, test.role, got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckPolicies(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		name    string
+		routes  func(router *mux.Router)
+		missing []string
+	}{
+		{
+			name: "all routes with policy",
+			routes: func(router *mux.Router) {
+				router.Handle("/login", WithPolicy(nil, PUBLIC, handler)).Methods(http.MethodPost)
+				api := router.PathPrefix("/api").Subrouter()
+				api.Handle("/users", WithPolicy(nil, RequirePermission(auth.PERMISSION_MANAGE_USERS), handler)).Methods(http.MethodGet)
+			},
+		},
+		{
+			name: "route without policy",
+			routes: func(router *mux.Router) {
+				router.Handle("/login", WithPolicy(nil, PUBLIC, handler)).Methods(http.MethodPost)
+				router.Handle("/posts", handler).Methods(http.MethodGet)
+			},
+			missing: []string{"GET /posts"},
+		},
+		{
+			name: "route without policy in subrouter",
+			routes: func(router *mux.Router) {
+				api := router.PathPrefix("/api").Subrouter()
+				api.Handle("/users", handler).Methods(http.MethodGet)
+			},
+			missing: []string{"GET /api/users"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			test.routes(router)
+			err := CheckPolicies(router)
+			if len(test.missing) == 0 {
+				if err != nil {
+					t.Errorf("CheckPolicies() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("CheckPolicies() = nil, want the routes %v", test.missing)
+			}
+			for _, route := range test.missing {
+				if !strings.Contains(err.Error(), route) {
+					t.Errorf("CheckPolicies() = %v, want it to include %q", err, route)
+				}
+			}
+		})
+	}
+}
@@ -2,8 +2,10 @@ package models
 
 import "github.com/golang-jwt/jwt"
 
+// AppClaims: claims de los access tokens, StandardClaims.Id es el jti que se usa para revocar el token
 type AppClaims struct {
 	UserId string `json:"userId"`
+	Role   string `json:"role,omitempty"`
 	jwt.StandardClaims
 }
 
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// LoginAttempt: intentos fallidos de login de una cuenta o de una ip, Key es "account:<email>"
+// o "ip:<ip>"; mientras LockedUntil esté en el futuro no se aceptan logins con esa key
+type LoginAttempt struct {
+	Key           string     `json:"key"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+}
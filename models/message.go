@@ -1,5 +1,13 @@
 package models
 
+// tipos de mensajes que se envían por websocket
+const (
+	POST_CREATED  = "Post_Created"
+	POST_UPDATED  = "Post_Updated"
+	POST_DELETED  = "Post_Deleted"
+	POST_RESTORED = "Post_Restored"
+)
+
 type WebsocketMessage struct {
 	Type    string      `json:"type"`
 	Payload interface{} `json:"payload"`
@@ -3,8 +3,19 @@ package models
 import "time"
 
 type Post struct {
-	Id          string    `json:"id"`
-	PostContent string    `json:"post_content"`
-	CreateAt    time.Time `json:"created_at"`
-	UserId      string    `json:"user_id"`
+	Id          string     `json:"id"`
+	PostContent string     `json:"post_content"`
+	CreateAt    time.Time  `json:"created_at"`
+	UserId      string     `json:"user_id"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	// ModeratedAt: si no es nil el post fue borrado por un moderador y el dueño no puede restaurarlo
+	ModeratedAt *time.Time `json:"moderated_at,omitempty"`
+	Version     int        `json:"version"`
+}
+
+// PostSearchResult: post encontrado en una búsqueda, con su relevancia y el fragmento resaltado
+type PostSearchResult struct {
+	Post
+	Rank    float64 `json:"rank"`
+	Snippet string  `json:"snippet"`
 }
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// PostRevision: versión del contenido de un post, se guarda una por cada creación o edición
+type PostRevision struct {
+	PostId      string    `json:"post_id"`
+	Revision    int       `json:"revision"`
+	PostContent string    `json:"post_content"`
+	EditorId    string    `json:"editor_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// RefreshToken: token de larga duración para obtener nuevos access tokens, solo se guarda
+// el hash del token; cada uso lo reemplaza por uno nuevo de la misma familia
+type RefreshToken struct {
+	Id        string     `json:"id"`
+	TokenHash string     `json:"-"`
+	UserId    string     `json:"user_id"`
+	FamilyId  string     `json:"family_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// PasswordResetToken: token del link para restablecer la contraseña, solo se guarda el hash
+type PasswordResetToken struct {
+	Id        string     `json:"id"`
+	TokenHash string     `json:"-"`
+	UserId    string     `json:"user_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+}
@@ -1,7 +1,15 @@
 package models
 
+import "time"
+
 type User struct {
-	Id       string `json:"id"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Id        string    `json:"id"`
+	Email     string    `json:"email"`
+	Password  string    `json:"password"`
+	CreatedAt time.Time `json:"created_at"`
+	Role      string    `json:"role"`
+	// DisabledAt: si no es nil el usuario fue deshabilitado por un administrador y no puede loguearse
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+	// EmailVerifiedAt: si es nil el usuario todavía no verificó su correo
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
 }
@@ -0,0 +1,134 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+	"w00k/go/rest-ws/models"
+	"w00k/go/rest-ws/repository"
+)
+
+// Publisher: destino de los eventos del outbox (hub de websockets, backplane, etc)
+type Publisher interface {
+	Publish(ctx context.Context, message models.WebsocketMessage) error
+}
+
+// PublisherFunc: permite usar una función como Publisher
+type PublisherFunc func(ctx context.Context, message models.WebsocketMessage) error
+
+func (f PublisherFunc) Publish(ctx context.Context, message models.WebsocketMessage) error {
+	return f(ctx, message)
+}
+
+// Enqueue: guarda un evento en el outbox, debe llamarse con el repositorio de la
+// misma transacción que guarda el cambio para que el evento no se pierda ni sea fantasma
+func Enqueue(ctx context.Context, repo repository.Repository, eventType string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return repo.InsertOutboxEvent(ctx, &models.OutboxEvent{
+		Type:    eventType,
+		Payload: data,
+	})
+}
+
+type Config struct {
+	Interval        time.Duration // cada cuánto se buscan eventos pendientes
+	BatchSize       int           // cantidad máxima de eventos por búsqueda
+	Retention       time.Duration // tiempo que se guardan los eventos entregados
+	CleanupInterval time.Duration // cada cuánto se borran los eventos entregados
+	// ClaimTimeout: tiempo que un lote queda reservado para este relay, si no se marca como
+	// entregado en ese tiempo (error o caída) otro relay lo vuelve a publicar
+	ClaimTimeout time.Duration
+}
+
+const DEFAULT_CLAIM_TIMEOUT = 30 * time.Second
+
+// Relay: publica los eventos pendientes del outbox, la entrega es at-least-once,
+// un evento se marca como entregado solo si todos los publishers lo aceptaron
+type Relay struct {
+	repo       repository.Repository
+	config     Config
+	publishers []Publisher
+}
+
+func NewRelay(repo repository.Repository, config Config, publishers ...Publisher) *Relay {
+	if config.ClaimTimeout <= 0 {
+		config.ClaimTimeout = DEFAULT_CLAIM_TIMEOUT
+	}
+	return &Relay{
+		repo:       repo,
+		config:     config,
+		publishers: publishers,
+	}
+}
+
+// Run: publica y limpia el outbox periódicamente hasta que se cancele el contexto
+func (relay *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(relay.config.Interval)
+	defer ticker.Stop()
+	cleanup := time.NewTicker(relay.config.CleanupInterval)
+	defer cleanup.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := relay.Flush(ctx); err != nil {
+				log.Println("outbox relay: ", err)
+			}
+		case <-cleanup.C:
+			deleted, err := relay.repo.DeleteDeliveredOutboxEvents(ctx, time.Now().Add(-relay.config.Retention))
+			if err != nil {
+				log.Println("outbox cleanup: ", err)
+			} else if deleted > 0 {
+				log.Printf("outbox cleanup: %d delivered events deleted\n", deleted)
+			}
+		}
+	}
+}
+
+// Flush: publica los eventos pendientes hasta vaciar el outbox, cada lote se reserva para que
+// otras instancias no lo publiquen y se publica fuera de una transacción, así un publisher lento
+// no deja filas bloqueadas ni transacciones abiertas
+func (relay *Relay) Flush(ctx context.Context) error {
+	for {
+		events, err := relay.repo.ClaimOutboxEvents(ctx, relay.config.BatchSize, relay.config.ClaimTimeout)
+		if err != nil {
+			return err
+		}
+		var delivered []int64
+		for _, event := range events {
+			if err := relay.publish(ctx, event); err != nil {
+				//se detiene en el primer error para respetar el orden de los eventos, el resto
+				//del lote se vuelve a publicar cuando vence la reserva
+				log.Printf("outbox relay: event %d: %v\n", event.Id, err)
+				break
+			}
+			delivered = append(delivered, event.Id)
+		}
+		if len(delivered) > 0 {
+			if err := relay.repo.MarkOutboxEventsDelivered(ctx, delivered); err != nil {
+				return err
+			}
+		}
+		if len(delivered) < relay.config.BatchSize {
+			return nil
+		}
+	}
+}
+
+func (relay *Relay) publish(ctx context.Context, event *models.OutboxEvent) error {
+	message := models.WebsocketMessage{
+		Type:    event.Type,
+		Payload: event.Payload,
+	}
+	for _, publisher := range relay.publishers {
+		if err := publisher.Publish(ctx, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+	"w00k/go/rest-ws/cache"
+	"w00k/go/rest-ws/metrics"
+	"w00k/go/rest-ws/models"
+)
+
+const (
+	postCachePrefix     = "post:"
+	postListCachePrefix = "posts:list:"
+)
+
+// CacheStats: aciertos y fallos de la caché del repositorio
+type CacheStats struct {
+	Hits   metrics.Counter
+	Misses metrics.Counter
+}
+
+// CachedRepository: decorador que guarda en caché GetPostById y ListPost e invalida
+// las entradas cuando se insertan, modifican, borran, restauran o importan posts, el resto de
+// las operaciones se delegan al repositorio que envuelve
+type CachedRepository struct {
+	Repository
+	cache cache.Cache
+	ttl   time.Duration
+	stats *CacheStats
+	// pending: posts modificados dentro de una transacción, se invalidan al terminarla
+	pending       *[]string
+	invalidations *invalidations
+}
+
+// invalidations: cantidad de invalidaciones, la comparten las copias del repositorio de las transacciones,
+// cached no guarda lo que cargó si hubo una invalidación mientras lo cargaba porque puede estar atrasado
+type invalidations struct {
+	mutex sync.Mutex
+	count uint64
+}
+
+func (i *invalidations) current() uint64 {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.count
+}
+
+func NewCachedRepository(next Repository, c cache.Cache, ttl time.Duration) *CachedRepository {
+	return &CachedRepository{
+		Repository:    next,
+		cache:         c,
+		ttl:           ttl,
+		stats:         &CacheStats{},
+		invalidations: &invalidations{},
+	}
+}
+
+// Stats: métricas de la caché, se puede publicar con expvar
+func (repo *CachedRepository) Stats() map[string]int64 {
+	return map[string]int64{
+		"hits":   repo.stats.Hits.Value(),
+		"misses": repo.stats.Misses.Value(),
+	}
+}
+
+func (repo *CachedRepository) GetPostById(ctx context.Context, id string) (*models.Post, error) {
+	if repo.pending != nil {
+		return repo.Repository.GetPostById(ctx, id)
+	}
+	var post *models.Post
+	err := repo.cached(ctx, postCachePrefix+id, &post, func(ctx context.Context) (interface{}, error) {
+		return repo.Repository.GetPostById(ctx, id)
+	})
+	return post, err
+}
+
+func (repo *CachedRepository) ListPost(ctx context.Context, options ListPostOptions) ([]*models.Post, error) {
+	if repo.pending != nil {
+		return repo.Repository.ListPost(ctx, options)
+	}
+	key, err := json.Marshal(options)
+	if err != nil {
+		return nil, err
+	}
+	var posts []*models.Post
+	err = repo.cached(ctx, postListCachePrefix+string(key), &posts, func(ctx context.Context) (interface{}, error) {
+		return repo.Repository.ListPost(ctx, options)
+	})
+	return posts, err
+}
+
+func (repo *CachedRepository) SearchPosts(ctx context.Context, options SearchPostOptions) ([]*models.PostSearchResult, error) {
+	return SearchPosts(ctx, repo.Repository, options)
+}
+
+func (repo *CachedRepository) InsertPost(ctx context.Context, post *models.Post) error {
+	err := repo.Repository.InsertPost(ctx, post)
+	repo.invalidate(ctx, post.Id)
+	return err
+}
+
+func (repo *CachedRepository) UpdatePost(ctx context.Context, post *models.Post) error {
+	err := repo.Repository.UpdatePost(ctx, post)
+	repo.invalidate(ctx, post.Id)
+	return err
+}
+
+func (repo *CachedRepository) DeletePost(ctx context.Context, id string, userId string) error {
+	err := repo.Repository.DeletePost(ctx, id, userId)
+	repo.invalidate(ctx, id)
+	return err
+}
+
+func (repo *CachedRepository) ForceDeletePost(ctx context.Context, id string) error {
+	err := repo.Repository.ForceDeletePost(ctx, id)
+	repo.invalidate(ctx, id)
+	return err
+}
+
+func (repo *CachedRepository) RestorePost(ctx context.Context, id string, userId string, deletedAfter time.Time) error {
+	err := repo.Repository.RestorePost(ctx, id, userId, deletedAfter)
+	repo.invalidate(ctx, id)
+	return err
+}
+
+func (repo *CachedRepository) UpsertPost(ctx context.Context, post *models.Post) error {
+	err := repo.Repository.UpsertPost(ctx, post)
+	repo.invalidate(ctx, post.Id)
+	return err
+}
+
+// WithTx: dentro de la transacción las lecturas no usan la caché para no guardar datos
+// sin commit, y las invalidaciones se aplican cuando la transacción termina
+func (repo *CachedRepository) WithTx(ctx context.Context, fn func(tx Repository) error) error {
+	if repo.pending != nil {
+		return repo.Repository.WithTx(ctx, func(tx Repository) error {
+			return fn(&CachedRepository{Repository: tx, cache: repo.cache, ttl: repo.ttl, stats: repo.stats, pending: repo.pending, invalidations: repo.invalidations})
+		})
+	}
+	var pending []string
+	err := repo.Repository.WithTx(ctx, func(tx Repository) error {
+		return fn(&CachedRepository{Repository: tx, cache: repo.cache, ttl: repo.ttl, stats: repo.stats, pending: &pending, invalidations: repo.invalidations})
+	})
+	for _, id := range pending {
+		repo.invalidate(ctx, id)
+	}
+	return err
+}
+
+// cached: obtiene value desde la caché, si no está lo carga con load desde el primario y lo guarda,
+// así una réplica atrasada no deja en la caché un post que ya se modificó; si se invalidó la caché
+// mientras se cargaba no se guarda, la carga pudo leer el post antes de la modificación;
+// los errores de la caché solo se registran para no afectar las consultas
+func (repo *CachedRepository) cached(ctx context.Context, key string, value interface{}, load func(ctx context.Context) (interface{}, error)) error {
+	data, ok, err := repo.cache.Get(ctx, key)
+	if err != nil {
+		log.Println("repository cache: ", err)
+	}
+	if ok {
+		if err := json.Unmarshal(data, value); err == nil {
+			repo.stats.Hits.Inc()
+			return nil
+		}
+	}
+	repo.stats.Misses.Inc()
+	generation := repo.invalidations.current()
+	loaded, err := load(WithPrimary(ctx))
+	if err != nil {
+		return err
+	}
+	if data, err = json.Marshal(loaded); err != nil {
+		return fmt.Errorf("repository cache: %w", err)
+	}
+	repo.invalidations.mutex.Lock()
+	if repo.invalidations.count == generation {
+		if err := repo.cache.Set(ctx, key, data, repo.ttl); err != nil {
+			log.Println("repository cache: ", err)
+		}
+	}
+	repo.invalidations.mutex.Unlock()
+	return json.Unmarshal(data, value)
+}
+
+// invalidate: borra el post y todos los listados de la caché, con el mutex de invalidations
+// para que ninguna carga en curso los vuelva a guardar después
+func (repo *CachedRepository) invalidate(ctx context.Context, id string) {
+	if repo.pending != nil {
+		*repo.pending = append(*repo.pending, id)
+		return
+	}
+	repo.invalidations.mutex.Lock()
+	defer repo.invalidations.mutex.Unlock()
+	repo.invalidations.count++
+	if err := repo.cache.Delete(ctx, postCachePrefix+id); err != nil {
+		log.Println("repository cache: ", err)
+	}
+	if err := repo.cache.DeletePrefix(ctx, postListCachePrefix); err != nil {
+		log.Println("repository cache: ", err)
+	}
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+	"w00k/go/rest-ws/cache"
+	"w00k/go/rest-ws/models"
+)
+
+// postsRepository: repositorio de prueba con un solo post, registra si cada lectura pidió el primario
+type postsRepository struct {
+	Repository
+	post        models.Post
+	readPrimary []bool
+	// onGet: si no es nil se llama durante la lectura, antes de retornar el post leído
+	onGet func()
+}
+
+func (repo *postsRepository) GetPostById(ctx context.Context, id string) (*models.Post, error) {
+	repo.readPrimary = append(repo.readPrimary, ReadsPrimary(ctx))
+	post := repo.post
+	if repo.onGet != nil {
+		repo.onGet()
+	}
+	return &post, nil
+}
+
+func (repo *postsRepository) UpdatePost(ctx context.Context, post *models.Post) error {
+	repo.post.PostContent = post.PostContent
+	repo.post.Version++
+	return nil
+}
+
+func TestCachedRepositoryLoadsFromPrimary(t *testing.T) {
+	ctx := context.Background()
+	next := &postsRepository{post: models.Post{Id: "1", Version: 1}}
+	repo := NewCachedRepository(next, cache.NewLRU(10), time.Minute)
+
+	for i := 0; i < 2; i++ {
+		if _, err := repo.GetPostById(ctx, "1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(next.readPrimary) != 1 || !next.readPrimary[0] {
+		t.Errorf("reads = %v, want one read from the primary", next.readPrimary)
+	}
+}
+
+func TestCachedRepositoryDoesNotCacheLoadRacingInvalidation(t *testing.T) {
+	ctx := context.Background()
+	next := &postsRepository{post: models.Post{Id: "1", Version: 1}}
+	repo := NewCachedRepository(next, cache.NewLRU(10), time.Minute)
+	//la modificación se guarda e invalida la caché mientras la primera lectura carga la versión 1
+	next.onGet = func() {
+		next.onGet = nil
+		if err := repo.UpdatePost(ctx, &models.Post{Id: "1", PostContent: "updated"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		version int
+	}{
+		{"load racing the update", 1},
+		{"next read", 2},
+		{"cached read", 2},
+	}
+	for _, test := range tests {
+		post, err := repo.GetPostById(ctx, "1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if post.Version != test.version {
+			t.Errorf("%s: version = %d, want %d", test.name, post.Version, test.version)
+		}
+	}
+	if len(next.readPrimary) != 2 {
+		t.Errorf("repository reads = %d, want 2", len(next.readPrimary))
+	}
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type writeTrackerKey struct{}
+
+// writeTracker: registra si el request ya escribió en el repositorio
+type writeTracker struct {
+	written int32
+}
+
+// WithWriteTracking: prepara el contexto de un request para registrar sus escrituras,
+// las implementaciones con réplicas lo usan para leer del primario después de escribir
+func WithWriteTracking(ctx context.Context) context.Context {
+	return context.WithValue(ctx, writeTrackerKey{}, &writeTracker{})
+}
+
+// MarkWritten: registra que el request escribió en el repositorio
+func MarkWritten(ctx context.Context) {
+	if tracker, ok := ctx.Value(writeTrackerKey{}).(*writeTracker); ok {
+		atomic.StoreInt32(&tracker.written, 1)
+	}
+}
+
+// HasWritten: indica si el request ya escribió en el repositorio
+func HasWritten(ctx context.Context) bool {
+	tracker, ok := ctx.Value(writeTrackerKey{}).(*writeTracker)
+	return ok && atomic.LoadInt32(&tracker.written) == 1
+}
+
+type primaryKey struct{}
+
+// WithPrimary: las lecturas con este contexto se hacen en el primario, la caché lo usa al cargar
+// las entradas para no guardar datos atrasados de una réplica durante todo su ttl
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// ReadsPrimary: indica si las lecturas del contexto deben hacerse en el primario
+func ReadsPrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryKey{}).(bool)
+	return primary
+}
+
+type snapshotKey struct{}
+
+// WithSnapshot: una transacción iniciada con este contexto solo lee y ve los datos como estaban
+// al empezar (REPEATABLE READ), el export lo usa para que el archivo sea consistente
+func WithSnapshot(ctx context.Context) context.Context {
+	return context.WithValue(ctx, snapshotKey{}, true)
+}
+
+// ReadsSnapshot: indica si la transacción del contexto debe ser de solo lectura sobre un snapshot
+func ReadsSnapshot(ctx context.Context) bool {
+	snapshot, _ := ctx.Value(snapshotKey{}).(bool)
+	return snapshot
+}
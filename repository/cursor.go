@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+	"w00k/go/rest-ws/models"
+)
+
+// ErrInvalidCursor: el cursor recibido no se puede decodificar
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// PostCursor: posición de un post dentro del listado ordenado por created_at, id
+type PostCursor struct {
+	CreatedAt time.Time `json:"t"`
+	Id        string    `json:"id"`
+}
+
+// PostSort: orden del listado de posts según su fecha de creación
+type PostSort string
+
+const (
+	SortOldest PostSort = "oldest"
+	SortNewest PostSort = "newest"
+)
+
+// ListPostOptions: parámetros para listar posts
+// - After: si no es nil, se listan los posts que siguen al cursor en el orden pedido (keyset)
+// - Page: página a listar con offset, solo se usa si After es nil
+// - Limit: cantidad máxima de posts a retornar
+// - UserId: si no es vacío, solo se listan los posts del usuario
+// - Since, Until: si no son nil, se listan los posts creados dentro del rango (inclusive)
+// - Sort: orden del listado, por defecto SortOldest
+type ListPostOptions struct {
+	After  *PostCursor
+	Page   uint64
+	Limit  int
+	UserId string
+	Since  *time.Time
+	Until  *time.Time
+	Sort   PostSort
+}
+
+// CursorFromPost: construye el cursor que apunta al post
+func CursorFromPost(post *models.Post) *PostCursor {
+	return &PostCursor{
+		CreatedAt: post.CreateAt,
+		Id:        post.Id,
+	}
+}
+
+// Encode: serializa el cursor en un string opaco para el cliente
+func (c *PostCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodePostCursor: obtiene el cursor desde el string entregado por el cliente,
+// si el string es inválido retorna ErrInvalidCursor
+func DecodePostCursor(value string) (*PostCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cursor PostCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if cursor.Id == "" || cursor.CreatedAt.IsZero() {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
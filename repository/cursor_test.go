@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+	"w00k/go/rest-ws/models"
+)
+
+func TestPostCursorRoundTrip(t *testing.T) {
+	post := &models.Post{Id: "2EKVlnHjYKpUHtFeuJXTpgYpkGp", CreateAt: time.Date(2022, 9, 6, 1, 2, 20, 120000000, time.UTC)}
+	cursor, err := DecodePostCursor(CursorFromPost(post).Encode())
+	if err != nil {
+		t.Fatalf("DecodePostCursor() error = %v", err)
+	}
+	if cursor.Id != post.Id || !cursor.CreatedAt.Equal(post.CreateAt) {
+		t.Errorf("DecodePostCursor() = %+v, want id %s and created_at %s", cursor, post.Id, post.CreateAt)
+	}
+}
+
+func TestDecodePostCursorRejectsInvalid(t *testing.T) {
+	encode := func(data string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(data))
+	}
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"empty", ""},
+		{"not base64", "not a cursor!"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte(`{"t":"2022-09-06T01:02:20Z","id":"a"}`))},
+		{"not json", encode("cursor")},
+		{"wrong types", encode(`{"t":1,"id":2}`)},
+		{"without id", encode(`{"t":"2022-09-06T01:02:20Z"}`)},
+		{"without created_at", encode(`{"id":"2EKVlnHjYKpUHtFeuJXTpgYpkGp"}`)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cursor, err := DecodePostCursor(test.value)
+			if !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("DecodePostCursor(%q) = %+v, %v, want ErrInvalidCursor", test.value, cursor, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package repository
+
+import "errors"
+
+// errores que las implementaciones del repositorio deben retornar para que
+// los handlers puedan responder con el código HTTP correcto
+var (
+	// ErrNotFound: el registro no existe
+	ErrNotFound = errors.New("not found")
+	// ErrForbidden: el registro existe pero pertenece a otro usuario
+	ErrForbidden = errors.New("forbidden")
+	// ErrNotDeleted: se intenta restaurar un registro que no está borrado
+	ErrNotDeleted = errors.New("not deleted")
+	// ErrRestoreExpired: el registro se borró antes del plazo permitido para restaurarlo
+	ErrRestoreExpired = errors.New("restore window expired")
+	// ErrVersionMismatch: el registro fue modificado después de la versión que se quiere actualizar
+	ErrVersionMismatch = errors.New("version mismatch")
+	// ErrTokenUsed: el refresh token ya se usó o fue revocado
+	ErrTokenUsed = errors.New("token already used")
+	// ErrLoginLocked: los logins de la cuenta o de la ip están bloqueados temporalmente
+	ErrLoginLocked = errors.New("login locked")
+)
@@ -0,0 +1,310 @@
+package repository
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+	"w00k/go/rest-ws/metrics"
+	"w00k/go/rest-ws/models"
+	"w00k/go/rest-ws/requestid"
+)
+
+// methodStats: métricas de un método del repositorio
+type methodStats struct {
+	calls   metrics.Counter
+	errors  metrics.Counter
+	latency metrics.Histogram
+}
+
+// InstrumentStats: métricas por método, compartidas entre el repositorio y sus transacciones
+type InstrumentStats struct {
+	mutex   sync.Mutex
+	methods map[string]*methodStats
+}
+
+func (stats *InstrumentStats) method(name string) *methodStats {
+	stats.mutex.Lock()
+	defer stats.mutex.Unlock()
+
+	method, ok := stats.methods[name]
+	if !ok {
+		method = &methodStats{}
+		stats.methods[name] = method
+	}
+	return method
+}
+
+// InstrumentedRepository: decorador que mide la latencia y los errores de cada método del
+// repositorio que envuelve y registra en el log las llamadas más lentas que slowThreshold,
+// se puede combinar con otros decoradores porque recibe y cumple la interfaz Repository
+type InstrumentedRepository struct {
+	next          Repository
+	slowThreshold time.Duration
+	stats         *InstrumentStats
+}
+
+func NewInstrumentedRepository(next Repository, slowThreshold time.Duration) *InstrumentedRepository {
+	return &InstrumentedRepository{
+		next:          next,
+		slowThreshold: slowThreshold,
+		stats:         &InstrumentStats{methods: make(map[string]*methodStats)},
+	}
+}
+
+// Stats: llamadas, errores y latencias por método, se puede publicar con expvar
+func (repo *InstrumentedRepository) Stats() map[string]interface{} {
+	repo.stats.mutex.Lock()
+	defer repo.stats.mutex.Unlock()
+
+	stats := make(map[string]interface{}, len(repo.stats.methods))
+	for name, method := range repo.stats.methods {
+		stats[name] = map[string]interface{}{
+			"calls":   method.calls.Value(),
+			"errors":  method.errors.Value(),
+			"latency": method.latency.Snapshot(),
+		}
+	}
+	return stats
+}
+
+// observe: se llama con defer al inicio de cada método para registrar su duración y resultado
+func (repo *InstrumentedRepository) observe(ctx context.Context, name string, start time.Time, err *error) {
+	elapsed := time.Since(start)
+	method := repo.stats.method(name)
+	method.calls.Inc()
+	method.latency.Observe(elapsed)
+	if *err != nil {
+		method.errors.Inc()
+	}
+	if repo.slowThreshold > 0 && elapsed >= repo.slowThreshold {
+		log.Printf("slow repository call: method=%s duration=%s request_id=%s error=%v\n", name, elapsed, requestid.From(ctx), *err)
+	}
+}
+
+func (repo *InstrumentedRepository) InsertUser(ctx context.Context, user *models.User) (err error) {
+	defer repo.observe(ctx, "InsertUser", time.Now(), &err)
+	return repo.next.InsertUser(ctx, user)
+}
+
+func (repo *InstrumentedRepository) GetUserById(ctx context.Context, id string) (user *models.User, err error) {
+	defer repo.observe(ctx, "GetUserById", time.Now(), &err)
+	return repo.next.GetUserById(ctx, id)
+}
+
+func (repo *InstrumentedRepository) GetUserByEmail(ctx context.Context, email string) (user *models.User, err error) {
+	defer repo.observe(ctx, "GetUserByEmail", time.Now(), &err)
+	return repo.next.GetUserByEmail(ctx, email)
+}
+
+func (repo *InstrumentedRepository) SetUserRole(ctx context.Context, userId string, role string) (err error) {
+	defer repo.observe(ctx, "SetUserRole", time.Now(), &err)
+	return repo.next.SetUserRole(ctx, userId, role)
+}
+
+func (repo *InstrumentedRepository) SetUserDisabled(ctx context.Context, userId string, disabled bool) (err error) {
+	defer repo.observe(ctx, "SetUserDisabled", time.Now(), &err)
+	return repo.next.SetUserDisabled(ctx, userId, disabled)
+}
+
+func (repo *InstrumentedRepository) MarkEmailVerified(ctx context.Context, userId string, email string) (err error) {
+	defer repo.observe(ctx, "MarkEmailVerified", time.Now(), &err)
+	return repo.next.MarkEmailVerified(ctx, userId, email)
+}
+
+func (repo *InstrumentedRepository) InsertPost(ctx context.Context, post *models.Post) (err error) {
+	defer repo.observe(ctx, "InsertPost", time.Now(), &err)
+	return repo.next.InsertPost(ctx, post)
+}
+
+func (repo *InstrumentedRepository) GetPostById(ctx context.Context, id string) (post *models.Post, err error) {
+	defer repo.observe(ctx, "GetPostById", time.Now(), &err)
+	return repo.next.GetPostById(ctx, id)
+}
+
+func (repo *InstrumentedRepository) UpdatePost(ctx context.Context, post *models.Post) (err error) {
+	defer repo.observe(ctx, "UpdatePost", time.Now(), &err)
+	return repo.next.UpdatePost(ctx, post)
+}
+
+func (repo *InstrumentedRepository) DeletePost(ctx context.Context, id string, userId string) (err error) {
+	defer repo.observe(ctx, "DeletePost", time.Now(), &err)
+	return repo.next.DeletePost(ctx, id, userId)
+}
+
+func (repo *InstrumentedRepository) ForceDeletePost(ctx context.Context, id string) (err error) {
+	defer repo.observe(ctx, "ForceDeletePost", time.Now(), &err)
+	return repo.next.ForceDeletePost(ctx, id)
+}
+
+func (repo *InstrumentedRepository) RestorePost(ctx context.Context, id string, userId string, deletedAfter time.Time) (err error) {
+	defer repo.observe(ctx, "RestorePost", time.Now(), &err)
+	return repo.next.RestorePost(ctx, id, userId, deletedAfter)
+}
+
+func (repo *InstrumentedRepository) PurgeDeletedPosts(ctx context.Context, before time.Time) (purged int64, err error) {
+	defer repo.observe(ctx, "PurgeDeletedPosts", time.Now(), &err)
+	return repo.next.PurgeDeletedPosts(ctx, before)
+}
+
+func (repo *InstrumentedRepository) ListPost(ctx context.Context, options ListPostOptions) (posts []*models.Post, err error) {
+	defer repo.observe(ctx, "ListPost", time.Now(), &err)
+	return repo.next.ListPost(ctx, options)
+}
+
+func (repo *InstrumentedRepository) SearchPosts(ctx context.Context, options SearchPostOptions) (results []*models.PostSearchResult, err error) {
+	defer repo.observe(ctx, "SearchPosts", time.Now(), &err)
+	return SearchPosts(ctx, repo.next, options)
+}
+
+func (repo *InstrumentedRepository) InsertPostRevision(ctx context.Context, revision *models.PostRevision) (err error) {
+	defer repo.observe(ctx, "InsertPostRevision", time.Now(), &err)
+	return repo.next.InsertPostRevision(ctx, revision)
+}
+
+func (repo *InstrumentedRepository) ListPostRevisions(ctx context.Context, postId string) (revisions []*models.PostRevision, err error) {
+	defer repo.observe(ctx, "ListPostRevisions", time.Now(), &err)
+	return repo.next.ListPostRevisions(ctx, postId)
+}
+
+func (repo *InstrumentedRepository) GetPostRevision(ctx context.Context, postId string, number int) (revision *models.PostRevision, err error) {
+	defer repo.observe(ctx, "GetPostRevision", time.Now(), &err)
+	return repo.next.GetPostRevision(ctx, postId, number)
+}
+
+func (repo *InstrumentedRepository) InsertOutboxEvent(ctx context.Context, event *models.OutboxEvent) (err error) {
+	defer repo.observe(ctx, "InsertOutboxEvent", time.Now(), &err)
+	return repo.next.InsertOutboxEvent(ctx, event)
+}
+
+func (repo *InstrumentedRepository) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) (events []*models.OutboxEvent, err error) {
+	defer repo.observe(ctx, "ClaimOutboxEvents", time.Now(), &err)
+	return repo.next.ClaimOutboxEvents(ctx, limit, lease)
+}
+
+func (repo *InstrumentedRepository) MarkOutboxEventsDelivered(ctx context.Context, ids []int64) (err error) {
+	defer repo.observe(ctx, "MarkOutboxEventsDelivered", time.Now(), &err)
+	return repo.next.MarkOutboxEventsDelivered(ctx, ids)
+}
+
+func (repo *InstrumentedRepository) DeleteDeliveredOutboxEvents(ctx context.Context, before time.Time) (deleted int64, err error) {
+	defer repo.observe(ctx, "DeleteDeliveredOutboxEvents", time.Now(), &err)
+	return repo.next.DeleteDeliveredOutboxEvents(ctx, before)
+}
+
+func (repo *InstrumentedRepository) ScanUsers(ctx context.Context, after string, limit int) (users []*models.User, err error) {
+	defer repo.observe(ctx, "ScanUsers", time.Now(), &err)
+	return repo.next.ScanUsers(ctx, after, limit)
+}
+
+func (repo *InstrumentedRepository) ScanPosts(ctx context.Context, after string, limit int) (posts []*models.Post, err error) {
+	defer repo.observe(ctx, "ScanPosts", time.Now(), &err)
+	return repo.next.ScanPosts(ctx, after, limit)
+}
+
+func (repo *InstrumentedRepository) UpsertUser(ctx context.Context, user *models.User) (err error) {
+	defer repo.observe(ctx, "UpsertUser", time.Now(), &err)
+	return repo.next.UpsertUser(ctx, user)
+}
+
+func (repo *InstrumentedRepository) UpsertPost(ctx context.Context, post *models.Post) (err error) {
+	defer repo.observe(ctx, "UpsertPost", time.Now(), &err)
+	return repo.next.UpsertPost(ctx, post)
+}
+
+func (repo *InstrumentedRepository) ScanPostRevisions(ctx context.Context, afterPostId string, afterRevision int, limit int) (revisions []*models.PostRevision, err error) {
+	defer repo.observe(ctx, "ScanPostRevisions", time.Now(), &err)
+	return repo.next.ScanPostRevisions(ctx, afterPostId, afterRevision, limit)
+}
+
+func (repo *InstrumentedRepository) UpsertPostRevision(ctx context.Context, revision *models.PostRevision) (err error) {
+	defer repo.observe(ctx, "UpsertPostRevision", time.Now(), &err)
+	return repo.next.UpsertPostRevision(ctx, revision)
+}
+
+func (repo *InstrumentedRepository) InsertRefreshToken(ctx context.Context, token *models.RefreshToken) (err error) {
+	defer repo.observe(ctx, "InsertRefreshToken", time.Now(), &err)
+	return repo.next.InsertRefreshToken(ctx, token)
+}
+
+func (repo *InstrumentedRepository) GetRefreshToken(ctx context.Context, tokenHash string) (token *models.RefreshToken, err error) {
+	defer repo.observe(ctx, "GetRefreshToken", time.Now(), &err)
+	return repo.next.GetRefreshToken(ctx, tokenHash)
+}
+
+func (repo *InstrumentedRepository) UseRefreshToken(ctx context.Context, id string) (err error) {
+	defer repo.observe(ctx, "UseRefreshToken", time.Now(), &err)
+	return repo.next.UseRefreshToken(ctx, id)
+}
+
+func (repo *InstrumentedRepository) RevokeRefreshTokenFamily(ctx context.Context, familyId string) (err error) {
+	defer repo.observe(ctx, "RevokeRefreshTokenFamily", time.Now(), &err)
+	return repo.next.RevokeRefreshTokenFamily(ctx, familyId)
+}
+
+func (repo *InstrumentedRepository) RevokeToken(ctx context.Context, jti string, userId string, expiresAt time.Time) (err error) {
+	defer repo.observe(ctx, "RevokeToken", time.Now(), &err)
+	return repo.next.RevokeToken(ctx, jti, userId, expiresAt)
+}
+
+func (repo *InstrumentedRepository) RevokeUserTokens(ctx context.Context, userId string, before time.Time) (err error) {
+	defer repo.observe(ctx, "RevokeUserTokens", time.Now(), &err)
+	return repo.next.RevokeUserTokens(ctx, userId, before)
+}
+
+func (repo *InstrumentedRepository) IsTokenRevoked(ctx context.Context, jti string, userId string, issuedAt time.Time) (revoked bool, err error) {
+	defer repo.observe(ctx, "IsTokenRevoked", time.Now(), &err)
+	return repo.next.IsTokenRevoked(ctx, jti, userId, issuedAt)
+}
+
+func (repo *InstrumentedRepository) InsertPasswordResetToken(ctx context.Context, token *models.PasswordResetToken) (err error) {
+	defer repo.observe(ctx, "InsertPasswordResetToken", time.Now(), &err)
+	return repo.next.InsertPasswordResetToken(ctx, token)
+}
+
+func (repo *InstrumentedRepository) UsePasswordResetToken(ctx context.Context, tokenHash string) (token *models.PasswordResetToken, err error) {
+	defer repo.observe(ctx, "UsePasswordResetToken", time.Now(), &err)
+	return repo.next.UsePasswordResetToken(ctx, tokenHash)
+}
+
+func (repo *InstrumentedRepository) ReserveLoginAttempt(ctx context.Context, key string, limit LoginLimit) (attempt *models.LoginAttempt, err error) {
+	defer repo.observe(ctx, "ReserveLoginAttempt", time.Now(), &err)
+	return repo.next.ReserveLoginAttempt(ctx, key, limit)
+}
+
+func (repo *InstrumentedRepository) ReleaseLoginAttempt(ctx context.Context, key string) (err error) {
+	defer repo.observe(ctx, "ReleaseLoginAttempt", time.Now(), &err)
+	return repo.next.ReleaseLoginAttempt(ctx, key)
+}
+
+func (repo *InstrumentedRepository) ResetLoginAttempts(ctx context.Context, key string) (err error) {
+	defer repo.observe(ctx, "ResetLoginAttempts", time.Now(), &err)
+	return repo.next.ResetLoginAttempts(ctx, key)
+}
+
+func (repo *InstrumentedRepository) PurgeLoginAttempts(ctx context.Context, before time.Time) (purged int64, err error) {
+	defer repo.observe(ctx, "PurgeLoginAttempts", time.Now(), &err)
+	return repo.next.PurgeLoginAttempts(ctx, before)
+}
+
+func (repo *InstrumentedRepository) PurgeExpiredTokens(ctx context.Context, before time.Time) (purged int64, err error) {
+	defer repo.observe(ctx, "PurgeExpiredTokens", time.Now(), &err)
+	return repo.next.PurgeExpiredTokens(ctx, before)
+}
+
+func (repo *InstrumentedRepository) UpdateUserPassword(ctx context.Context, userId string, password string) (err error) {
+	defer repo.observe(ctx, "UpdateUserPassword", time.Now(), &err)
+	return repo.next.UpdateUserPassword(ctx, userId, password)
+}
+
+// WithTx: mide la transacción completa y las operaciones que se hacen dentro de ella
+func (repo *InstrumentedRepository) WithTx(ctx context.Context, fn func(tx Repository) error) (err error) {
+	defer repo.observe(ctx, "WithTx", time.Now(), &err)
+	return repo.next.WithTx(ctx, func(tx Repository) error {
+		return fn(&InstrumentedRepository{next: tx, slowThreshold: repo.slowThreshold, stats: repo.stats})
+	})
+}
+
+func (repo *InstrumentedRepository) Close() error {
+	return repo.next.Close()
+}
@@ -2,60 +2,91 @@ package repository
 
 import (
 	"context"
+	"time"
 	"w00k/go/rest-ws/models"
 )
 
 // UserRepository: es la interfaz que contiene todas las operaciones CRUD que se pueden realizar
+// UpdatePost y DeletePost retornan ErrNotFound si el post no existe y ErrForbidden si pertenece a otro usuario
+// DeletePost es un borrado lógico, los posts borrados no se obtienen en GetPostById, ListPost ni en las búsquedas
 type Repository interface {
 	InsertUser(ctx context.Context, user *models.User) error
 	GetUserById(ctx context.Context, id string) (*models.User, error)
 	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	// SetUserRole y SetUserDisabled retornan ErrNotFound si el usuario no existe
+	SetUserRole(ctx context.Context, userId string, role string) error
+	SetUserDisabled(ctx context.Context, userId string, disabled bool) error
+	// MarkEmailVerified retorna ErrNotFound si el usuario no existe o ya no tiene ese correo
+	MarkEmailVerified(ctx context.Context, userId string, email string) error
 	InsertPost(ctx context.Context, post *models.Post) error
 	GetPostById(ctx context.Context, id string) (*models.Post, error)
 	UpdatePost(ctx context.Context, post *models.Post) error
 	DeletePost(ctx context.Context, id string, userId string) error
-	ListPost(ctx context.Context, page uint64) ([]*models.Post, error)
+	// ForceDeletePost: borra el post de cualquier usuario (moderación), retorna ErrNotFound si no existe
+	ForceDeletePost(ctx context.Context, id string) error
+	RestorePost(ctx context.Context, id string, userId string, deletedAfter time.Time) error
+	PurgeDeletedPosts(ctx context.Context, before time.Time) (int64, error)
+	ListPost(ctx context.Context, options ListPostOptions) ([]*models.Post, error)
+	InsertPostRevision(ctx context.Context, revision *models.PostRevision) error
+	ListPostRevisions(ctx context.Context, postId string) ([]*models.PostRevision, error)
+	GetPostRevision(ctx context.Context, postId string, number int) (*models.PostRevision, error)
+	InsertOutboxEvent(ctx context.Context, event *models.OutboxEvent) error
+	// ClaimOutboxEvents: toma los eventos pendientes que no tomó otro relay y los reserva durante lease
+	ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxEvent, error)
+	MarkOutboxEventsDelivered(ctx context.Context, ids []int64) error
+	DeleteDeliveredOutboxEvents(ctx context.Context, before time.Time) (int64, error)
+	// ScanUsers y ScanPosts recorren todos los registros ordenados por id, empezando después de after,
+	// ScanPosts incluye los posts borrados; UpsertUser y UpsertPost insertan o reemplazan por id
+	// conservando los ids, fechas, contraseñas y versiones recibidos
+	ScanUsers(ctx context.Context, after string, limit int) ([]*models.User, error)
+	ScanPosts(ctx context.Context, after string, limit int) ([]*models.Post, error)
+	UpsertUser(ctx context.Context, user *models.User) error
+	UpsertPost(ctx context.Context, post *models.Post) error
+	// ScanPostRevisions y UpsertPostRevision hacen lo mismo con las revisiones, ordenadas por post y número
+	ScanPostRevisions(ctx context.Context, afterPostId string, afterRevision int, limit int) ([]*models.PostRevision, error)
+	UpsertPostRevision(ctx context.Context, revision *models.PostRevision) error
+	InsertRefreshToken(ctx context.Context, token *models.RefreshToken) error
+	// GetRefreshToken: obtiene el refresh token por su hash aunque esté usado, revocado o expirado,
+	// retorna ErrNotFound si no existe
+	GetRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error)
+	// UseRefreshToken: marca el refresh token como usado, retorna ErrTokenUsed si ya se había usado o
+	// fue revocado, así dos requests concurrentes con el mismo token no pueden rotarlo los dos
+	UseRefreshToken(ctx context.Context, id string) error
+	RevokeRefreshTokenFamily(ctx context.Context, familyId string) error
+	// RevokeToken: revoca el access token con ese jti hasta que expire
+	RevokeToken(ctx context.Context, jti string, userId string, expiresAt time.Time) error
+	// RevokeUserTokens: invalida todos los access tokens del usuario emitidos antes de before
+	// y revoca todos sus refresh tokens
+	RevokeUserTokens(ctx context.Context, userId string, before time.Time) error
+	// IsTokenRevoked: indica si el access token fue revocado por su jti o por RevokeUserTokens
+	IsTokenRevoked(ctx context.Context, jti string, userId string, issuedAt time.Time) (bool, error)
+	InsertPasswordResetToken(ctx context.Context, token *models.PasswordResetToken) error
+	// UsePasswordResetToken: marca como usado el token con ese hash y los demás tokens pendientes del
+	// usuario, retorna ErrNotFound si no existe, ya se usó o expiró
+	UsePasswordResetToken(ctx context.Context, tokenHash string) (*models.PasswordResetToken, error)
+	// PurgeExpiredTokens: elimina los refresh tokens, los tokens para restablecer la contraseña
+	// y las revocaciones que expiraron antes de before
+	PurgeExpiredTokens(ctx context.Context, before time.Time) (int64, error)
+	UpdateUserPassword(ctx context.Context, userId string, password string) error
+	// ReserveLoginAttempt: cuenta el intento de login como fallido antes de validar la contraseña y bloquea
+	// la key si supera limit, retorna ErrLoginLocked (con los intentos de la key) si ya estaba bloqueada
+	ReserveLoginAttempt(ctx context.Context, key string, limit LoginLimit) (*models.LoginAttempt, error)
+	// ReleaseLoginAttempt: descuenta un intento reservado que no falló
+	ReleaseLoginAttempt(ctx context.Context, key string) error
+	ResetLoginAttempts(ctx context.Context, key string) error
+	// PurgeLoginAttempts: elimina los intentos no bloqueados cuyo último fallo fue antes de before
+	PurgeLoginAttempts(ctx context.Context, before time.Time) (int64, error)
+	// WithTx: ejecuta fn dentro de una transacción, si fn retorna error se deshacen todos los cambios
+	// hechos con tx, las llamadas anidadas a WithTx deben ser seguras
+	WithTx(ctx context.Context, fn func(tx Repository) error) error
 	Close() error
 }
 
-var implementation Repository
-
-func SetRespository(repository Repository) {
-	implementation = repository
-}
-
-func InsertUser(ctx context.Context, user *models.User) error {
-	return implementation.InsertUser(ctx, user)
-}
-
-func GetUserById(ctx context.Context, id string) (*models.User, error) {
-	return implementation.GetUserById(ctx, id)
-}
-
-func GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
-	return implementation.GetUserByEmail(ctx, email)
-}
-
-func InsertPost(ctx context.Context, post *models.Post) error {
-	return implementation.InsertPost(ctx, post)
-}
-
-func Close() error {
-	return implementation.Close()
-}
-
-func GetPostById(ctx context.Context, id string) (*models.Post, error) {
-	return implementation.GetPostById(ctx, id)
-}
-
-func UpdatePost(ctx context.Context, post *models.Post) error {
-	return implementation.UpdatePost(ctx, post)
-}
-
-func DeletePost(ctx context.Context, id string, userId string) error {
-	return implementation.DeletePost(ctx, id, userId)
-}
-
-func ListPost(ctx context.Context, page uint64) ([]*models.Post, error) {
-	return implementation.ListPost(ctx, page)
+// LoginLimit: intentos fallidos permitidos para una key de login, después de MaxAttempts cada intento
+// bloquea la key el doble de tiempo que el anterior, partiendo en Backoff y hasta Lockout; los intentos
+// se olvidan después de Lockout sin fallos
+type LoginLimit struct {
+	MaxAttempts int
+	Backoff     time.Duration
+	Lockout     time.Duration
 }
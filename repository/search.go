@@ -0,0 +1,175 @@
+package repository
+
+import (
+	"context"
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+	"w00k/go/rest-ws/models"
+)
+
+const (
+	HIGHLIGHT_START = "<b>"
+	HIGHLIGHT_STOP  = "</b>"
+	// HIGHLIGHT_MARK_START y HIGHLIGHT_MARK_STOP: marcas que no son HTML (caracteres de uso privado)
+	// para que la base de datos resalte las palabras, HighlightSnippet las reemplaza por los tags
+	// después de escapar el contenido
+	HIGHLIGHT_MARK_START = "\uE000"
+	HIGHLIGHT_MARK_STOP  = "\uE001"
+
+	// cantidad de posts que lee la búsqueda de respaldo en cada llamada a ListPost
+	fallbackSearchBatch = 100
+)
+
+// SearchPostOptions: parámetros de búsqueda de posts
+// - Query: texto a buscar, se buscan los posts que contienen todas sus palabras
+// - Offset: cantidad de resultados a saltar
+// - Limit: cantidad máxima de resultados a retornar
+type SearchPostOptions struct {
+	Query  string
+	Offset uint64
+	Limit  int
+}
+
+// PostSearcher: interfaz opcional para los repositorios que tienen búsqueda nativa,
+// los resultados se ordenan de mayor a menor relevancia
+type PostSearcher interface {
+	SearchPosts(ctx context.Context, options SearchPostOptions) ([]*models.PostSearchResult, error)
+}
+
+// SearchPosts: busca posts usando la búsqueda del repositorio si la implementa,
+// si no usa una búsqueda de respaldo que recorre todos los posts con ListPost
+func SearchPosts(ctx context.Context, repo Repository, options SearchPostOptions) ([]*models.PostSearchResult, error) {
+	if searcher, ok := repo.(PostSearcher); ok {
+		return searcher.SearchPosts(ctx, options)
+	}
+	return fallbackSearch(ctx, repo, options)
+}
+
+// fallbackSearch: búsqueda simple en memoria, un post coincide si contiene todas
+// las palabras de la búsqueda y su relevancia es la proporción de palabras que coinciden
+func fallbackSearch(ctx context.Context, repo Repository, options SearchPostOptions) ([]*models.PostSearchResult, error) {
+	terms := make(map[string]bool)
+	for _, term := range searchTerms(options.Query) {
+		terms[term] = true
+	}
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	var results []*models.PostSearchResult
+	list := ListPostOptions{Limit: fallbackSearchBatch, Sort: SortOldest}
+	for {
+		posts, err := repo.ListPost(ctx, list)
+		if err != nil {
+			return nil, err
+		}
+		for _, post := range posts {
+			if rank := matchRank(post.PostContent, terms); rank > 0 {
+				results = append(results, &models.PostSearchResult{
+					Post:    *post,
+					Rank:    rank,
+					Snippet: highlight(post.PostContent, terms),
+				})
+			}
+		}
+		if len(posts) < fallbackSearchBatch {
+			break
+		}
+		list.After = CursorFromPost(posts[len(posts)-1])
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return results[i].CreateAt.After(results[j].CreateAt)
+	})
+	start := options.Offset
+	if start >= uint64(len(results)) {
+		return nil, nil
+	}
+	end := start + uint64(options.Limit)
+	if end > uint64(len(results)) {
+		end = uint64(len(results))
+	}
+	return results[start:end], nil
+}
+
+// searchTerms: separa el texto en palabras en minúsculas
+func searchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// matchRank: retorna 0 si al contenido le falta alguna palabra, si no la proporción
+// de palabras del contenido que son parte de la búsqueda
+func matchRank(content string, terms map[string]bool) float64 {
+	words := searchTerms(content)
+	found := make(map[string]bool)
+	matches := 0
+	for _, word := range words {
+		if terms[word] {
+			found[word] = true
+			matches++
+		}
+	}
+	if len(found) < len(terms) {
+		return 0
+	}
+	return float64(matches) / float64(len(words))
+}
+
+// HighlightSnippet: convierte el contenido resaltado con las marcas en HTML, el contenido se escapa
+// para que un post con HTML no se pueda ejecutar en los clientes que muestran el snippet
+func HighlightSnippet(marked string) string {
+	var builder strings.Builder
+	for {
+		start := strings.Index(marked, HIGHLIGHT_MARK_START)
+		if start < 0 {
+			break
+		}
+		stop := strings.Index(marked[start:], HIGHLIGHT_MARK_STOP)
+		if stop < 0 {
+			break
+		}
+		builder.WriteString(escapeSnippet(marked[:start]))
+		builder.WriteString(HIGHLIGHT_START + escapeSnippet(marked[start+len(HIGHLIGHT_MARK_START):start+stop]) + HIGHLIGHT_STOP)
+		marked = marked[start+stop+len(HIGHLIGHT_MARK_STOP):]
+	}
+	builder.WriteString(escapeSnippet(marked))
+	return builder.String()
+}
+
+// escapeSnippet: escapa el HTML y quita las marcas sueltas, por ejemplo si el post las contiene
+func escapeSnippet(text string) string {
+	text = strings.NewReplacer(HIGHLIGHT_MARK_START, "", HIGHLIGHT_MARK_STOP, "").Replace(text)
+	return html.EscapeString(text)
+}
+
+// highlight: resalta en content las palabras de terms, el resultado es HTML escapado
+func highlight(content string, terms map[string]bool) string {
+	var builder strings.Builder
+	var word []rune
+	flush := func() {
+		if len(word) == 0 {
+			return
+		}
+		if terms[strings.ToLower(string(word))] {
+			builder.WriteString(HIGHLIGHT_START + escapeSnippet(string(word)) + HIGHLIGHT_STOP)
+		} else {
+			builder.WriteString(escapeSnippet(string(word)))
+		}
+		word = word[:0]
+	}
+	for _, r := range content {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			word = append(word, r)
+			continue
+		}
+		flush()
+		builder.WriteString(escapeSnippet(string(r)))
+	}
+	flush()
+	return builder.String()
+}
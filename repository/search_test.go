@@ -0,0 +1,33 @@
+package repository
+
+import "testing"
+
+func TestHighlightSnippetEscapesContent(t *testing.T) {
+	tests := []struct {
+		name   string
+		marked string
+		want   string
+	}{
+		{"plain", "mi primer post", "mi primer post"},
+		{"marked", "mi " + HIGHLIGHT_MARK_START + "primer" + HIGHLIGHT_MARK_STOP + " post", "mi <b>primer</b> post"},
+		{"html", `<img src=x onerror=alert(1)> ` + HIGHLIGHT_MARK_START + "post" + HIGHLIGHT_MARK_STOP, "&lt;img src=x onerror=alert(1)&gt; <b>post</b>"},
+		{"html inside mark", HIGHLIGHT_MARK_START + "<script>" + HIGHLIGHT_MARK_STOP, "<b>&lt;script&gt;</b>"},
+		{"unpaired marks", "a" + HIGHLIGHT_MARK_STOP + "b" + HIGHLIGHT_MARK_START + "c", "abc"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := HighlightSnippet(test.marked); got != test.want {
+				t.Errorf("HighlightSnippet(%q) = %q, want %q", test.marked, got, test.want)
+			}
+		})
+	}
+}
+
+func TestHighlightEscapesContent(t *testing.T) {
+	terms := map[string]bool{"post": true}
+	got := highlight(`<a href="x">Post</a> & post`, terms)
+	want := `&lt;a href=&#34;x&#34;&gt;<b>Post</b>&lt;/a&gt; &amp; <b>post</b>`
+	if got != want {
+		t.Errorf("highlight() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,55 @@
+package requestid
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	HEADER = "X-Request-Id"
+	// MAX_LENGTH: largo máximo del id que envía el cliente
+	MAX_LENGTH = 64
+)
+
+type contextKey struct{}
+
+// With: guarda el id del request en el contexto
+func With(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// From: obtiene el id del request desde el contexto, si no existe retorna vacío
+func From(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Valid: el id no es vacío, tiene hasta MAX_LENGTH caracteres y solo letras, números, '.', '_' y '-',
+// así se puede escribir en el log sin comillas y el cliente no puede agregar campos a la línea
+func Valid(id string) bool {
+	if id == "" || len(id) > MAX_LENGTH {
+		return false
+	}
+	for _, c := range id {
+		valid := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '.' || c == '_' || c == '-'
+		if !valid {
+			return false
+		}
+	}
+	return true
+}
+
+// Middleware: usa el header X-Request-Id que envía el cliente si es válido (Valid) o genera uno nuevo,
+// lo guarda en el contexto y lo retorna en el response
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(HEADER)
+		if !Valid(id) {
+			id = ksuid.New().String()
+		}
+		w.Header().Set(HEADER, id)
+		next.ServeHTTP(w, r.WithContext(With(r.Context(), id)))
+	})
+}
@@ -0,0 +1,49 @@
+package requestid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		keep   bool
+	}{
+		{"ksuid", "2G1ko5e6NxdTyObGrQOyrFQkXKk", true},
+		{"uuid", "3f2c1a9e-7b4d-4c1e-9a8f-0d6e5b4c3a21", true},
+		{"dots and underscores", "trace_1.span-2", true},
+		{"missing", "", false},
+		{"too long", strings.Repeat("a", MAX_LENGTH+1), false},
+		{"forged log fields", `x event=login.lockout key="account:admin@x.com"`, false},
+		{"newline", "abc\naudit: event=login.lockout", false},
+		{"non ascii", "ñandú", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var fromContext string
+			handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fromContext = From(r.Context())
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.header != "" {
+				r.Header.Set(HEADER, test.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if fromContext != w.Header().Get(HEADER) {
+				t.Errorf("context id %q != response id %q", fromContext, w.Header().Get(HEADER))
+			}
+			if kept := fromContext == test.header; kept != test.keep {
+				t.Errorf("id = %q, want header kept = %v", fromContext, test.keep)
+			}
+			if !Valid(fromContext) {
+				t.Errorf("id %q is not valid", fromContext)
+			}
+		})
+	}
+}
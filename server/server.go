@@ -3,31 +3,146 @@ package server
 import (
 	"context"
 	"errors"
+	"expvar"
 	"log"
 	"net/http"
+	"strings"
+	"time"
+	"w00k/go/rest-ws/auth"
+	"w00k/go/rest-ws/cache"
 	"w00k/go/rest-ws/database"
+	"w00k/go/rest-ws/mailer"
+	"w00k/go/rest-ws/metrics"
+	"w00k/go/rest-ws/models"
+	"w00k/go/rest-ws/outbox"
 	"w00k/go/rest-ws/repository"
+	"w00k/go/rest-ws/requestid"
 	"w00k/go/rest-ws/websocket"
 
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
 )
 
+const (
+	DEFAULT_PAGE_SIZE             = 10
+	DEFAULT_MAX_PAGE_SIZE         = 100
+	DEFAULT_OUTBOX_INTERVAL       = 500 * time.Millisecond
+	DEFAULT_OUTBOX_RETENTION      = 24 * time.Hour
+	DEFAULT_RESTORE_WINDOW        = 7 * 24 * time.Hour
+	DEFAULT_POST_RETENTION        = 30 * 24 * time.Hour
+	PURGE_INTERVAL                = time.Hour
+	DEFAULT_CACHE_SIZE            = 1000
+	DEFAULT_CACHE_TTL             = 30 * time.Second
+	DEFAULT_SLOW_QUERY            = 200 * time.Millisecond
+	DEFAULT_ACCESS_TOKEN_TTL      = 15 * time.Minute
+	DEFAULT_REFRESH_TOKEN_TTL     = 30 * 24 * time.Hour
+	DEFAULT_JWT_KEY_ROTATION      = 24 * time.Hour
+	DEFAULT_VERIFICATION_TTL      = 24 * time.Hour
+	DEFAULT_PASSWORD_RESET_TTL    = time.Hour
+	DEFAULT_MAIL_FROM             = "no-reply@localhost"
+	DEFAULT_LOGIN_MAX_ATTEMPTS    = 5
+	DEFAULT_LOGIN_IP_MAX_ATTEMPTS = 20
+	DEFAULT_LOGIN_BACKOFF         = time.Second
+	DEFAULT_LOGIN_LOCKOUT         = 15 * time.Minute
+	DEFAULT_TRUSTED_PROXY_HOPS    = 1
+)
+
 type Config struct {
 	Port      string
-	JWTSecret string
-	DataUrl   string
+	JWTSecret string // secreto para firmar los tokens con HS256
+	// JWTAlgorithm: HS256 (por defecto), RS256 o ES256
+	JWTAlgorithm string
+	// JWTPrivateKeyFiles: llaves privadas PEM para RS256/ES256, la primera firma y las demás solo validan,
+	// si no hay se genera una llave al iniciar y se rota cada JWTKeyRotation
+	JWTPrivateKeyFiles []string
+	JWTKeyRotation     time.Duration
+	// JWTKeyOverlap: tiempo que una llave rotada sigue validando tokens, por defecto AccessTokenTTL
+	JWTKeyOverlap   time.Duration
+	DataUrl         string
+	PageSize        int           // cantidad de posts por página si el cliente no envía limit
+	MaxPageSize     int           // límite máximo que puede solicitar el cliente
+	OutboxInterval  time.Duration // cada cuánto se publican los eventos pendientes del outbox
+	OutboxRetention time.Duration // tiempo que se guardan los eventos ya entregados
+	// PostRestoreWindow: tiempo que tiene el dueño para restaurar un post borrado
+	PostRestoreWindow time.Duration
+	// PostRetention: tiempo que se guardan los posts borrados antes de eliminarlos definitivamente
+	PostRetention time.Duration
+	CacheSize     int           // cantidad máxima de entradas en la caché del repositorio
+	CacheTTL      time.Duration // tiempo que se guarda una consulta en la caché del repositorio
+	// ReplicaUrls: réplicas de lectura de la base de datos, las escrituras siempre van a DataUrl
+	ReplicaUrls []string
+	// ReadYourWrites: después de escribir, el resto del request lee desde el primario
+	ReadYourWrites bool
+	// pool de conexiones de la base de datos, en cero se usan los valores por defecto de database.Config
+	DBMaxOpenConns    int
+	DBMaxIdleConns    int
+	DBConnMaxLifetime time.Duration
+	DBConnMaxIdleTime time.Duration
+	// DBConnectRetries: reintentos al conectarse a la base de datos al iniciar, con backoff exponencial
+	DBConnectRetries int
+	// SlowQueryThreshold: las llamadas al repositorio que tarden más se registran en el log
+	SlowQueryThreshold time.Duration
+	AccessTokenTTL     time.Duration // duración de los access tokens (JWT)
+	RefreshTokenTTL    time.Duration // duración de los refresh tokens, cada uso entrega uno nuevo
+	// PublicUrl: url con la que los usuarios acceden al servidor, se usa en los links de los correos
+	PublicUrl string
+	// VerificationSecret: secreto de los links de verificación de correo, por defecto JWTSecret,
+	// si no hay ninguno se genera uno al iniciar y los links dejan de servir al reiniciar
+	VerificationSecret string
+	VerificationTTL    time.Duration // duración de los links de verificación de correo
+	PasswordResetTTL   time.Duration // duración de los links para restablecer la contraseña
+	// PasswordResetUrl: formulario del cliente donde se elige la nueva contraseña, el link del correo
+	// le agrega el parámetro token; por defecto es el formulario que sirve GET /password/reset
+	PasswordResetUrl  string
+	PasswordMinLength int // largo mínimo de las contraseñas nuevas, por defecto 8
+	// BreachedPasswordsFile: archivo con contraseñas filtradas (una por línea) que se rechazan,
+	// se suma a la lista incluida en el binario
+	BreachedPasswordsFile string
+	// LoginMaxAttempts y LoginIpMaxAttempts: intentos fallidos de login permitidos por cuenta y por ip,
+	// después de eso cada fallo bloquea la cuenta o la ip el doble de tiempo que el anterior,
+	// partiendo en LoginBackoff y hasta LoginLockout
+	LoginMaxAttempts   int
+	LoginIpMaxAttempts int
+	LoginBackoff       time.Duration
+	// LoginLockout: bloqueo máximo, también es el tiempo sin fallos después del cual se olvidan los intentos
+	LoginLockout time.Duration
+	// TrustProxyHeaders: la ip del cliente se obtiene de X-Forwarded-For, solo si el servidor está detrás de un proxy
+	TrustProxyHeaders bool
+	// TrustedProxyHops: cantidad de proxies de confianza que agregan su ip a X-Forwarded-For
+	TrustedProxyHops int
+	// RequireVerifiedEmail: los usuarios deben verificar su correo antes de publicar
+	RequireVerifiedEmail bool
+	// SMTPHost: servidor SMTP para enviar correos, si está vacío los correos se escriben en MailFile o en el log
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	MailFrom     string
+	MailFile     string
 }
 
 type Server interface {
 	Config() *Config
 	Hub() *websocket.Hub
+	Repository() repository.Repository
+	Keys() *auth.KeyManager
+	Signer() *auth.Signer
+	Mailer() mailer.Mailer
+	PasswordPolicy() *auth.PasswordPolicy
+	Metrics() *metrics.Registry
 }
 
 type Broker struct {
-	config *Config
-	router *mux.Router
-	hub    *websocket.Hub
+	config     *Config
+	router     *mux.Router
+	hub        *websocket.Hub
+	repo       repository.Repository
+	keys       *auth.KeyManager
+	signer     *auth.Signer
+	mailer     mailer.Mailer
+	passwords  *auth.PasswordPolicy
+	metrics    *metrics.Registry
+	publishers []outbox.Publisher
 }
 
 func (b *Broker) Config() *Config {
@@ -38,36 +153,291 @@ func (b *Broker) Hub() *websocket.Hub {
 	return b.hub
 }
 
+// Repository: repositorio de este servidor, los handlers lo obtienen en cada request
+func (b *Broker) Repository() repository.Repository {
+	return b.repo
+}
+
 func NewServer(ctx context.Context, config *Config) (*Broker, error) {
 	if config.Port == "" {
 		return nil, errors.New("port is required")
 	}
-	if config.JWTSecret == "" {
-		return nil, errors.New("secret is required")
-	}
 	if config.DataUrl == "" {
 		return nil, errors.New("database is required")
 	}
+	if config.PageSize <= 0 {
+		config.PageSize = DEFAULT_PAGE_SIZE
+	}
+	if config.MaxPageSize <= 0 {
+		config.MaxPageSize = DEFAULT_MAX_PAGE_SIZE
+	}
+	if config.PageSize > config.MaxPageSize {
+		config.PageSize = config.MaxPageSize
+	}
+	if config.OutboxInterval <= 0 {
+		config.OutboxInterval = DEFAULT_OUTBOX_INTERVAL
+	}
+	if config.OutboxRetention <= 0 {
+		config.OutboxRetention = DEFAULT_OUTBOX_RETENTION
+	}
+	if config.PostRestoreWindow <= 0 {
+		config.PostRestoreWindow = DEFAULT_RESTORE_WINDOW
+	}
+	if config.PostRetention <= 0 {
+		config.PostRetention = DEFAULT_POST_RETENTION
+	}
+	if config.CacheSize <= 0 {
+		config.CacheSize = DEFAULT_CACHE_SIZE
+	}
+	if config.CacheTTL <= 0 {
+		config.CacheTTL = DEFAULT_CACHE_TTL
+	}
+	if config.SlowQueryThreshold <= 0 {
+		config.SlowQueryThreshold = DEFAULT_SLOW_QUERY
+	}
+	if config.AccessTokenTTL <= 0 {
+		config.AccessTokenTTL = DEFAULT_ACCESS_TOKEN_TTL
+	}
+	if config.RefreshTokenTTL <= 0 {
+		config.RefreshTokenTTL = DEFAULT_REFRESH_TOKEN_TTL
+	}
+	if config.RefreshTokenTTL < config.AccessTokenTTL {
+		return nil, errors.New("refresh token ttl must be greater than the access token ttl")
+	}
+	if config.JWTKeyRotation <= 0 {
+		config.JWTKeyRotation = DEFAULT_JWT_KEY_ROTATION
+	}
+	if config.JWTKeyOverlap <= 0 {
+		config.JWTKeyOverlap = config.AccessTokenTTL
+	}
+	if config.JWTKeyOverlap < config.AccessTokenTTL {
+		return nil, errors.New("jwt key overlap must be greater than the access token ttl")
+	}
+	if config.PublicUrl == "" {
+		config.PublicUrl = "http://localhost" + config.Port
+	}
+	config.PublicUrl = strings.TrimSuffix(config.PublicUrl, "/")
+	if config.PasswordResetUrl == "" {
+		config.PasswordResetUrl = config.PublicUrl + "/password/reset"
+	}
+	if config.VerificationSecret == "" {
+		config.VerificationSecret = config.JWTSecret
+	}
+	if config.VerificationTTL <= 0 {
+		config.VerificationTTL = DEFAULT_VERIFICATION_TTL
+	}
+	if config.LoginMaxAttempts <= 0 {
+		config.LoginMaxAttempts = DEFAULT_LOGIN_MAX_ATTEMPTS
+	}
+	if config.LoginIpMaxAttempts <= 0 {
+		config.LoginIpMaxAttempts = DEFAULT_LOGIN_IP_MAX_ATTEMPTS
+	}
+	if config.LoginBackoff <= 0 {
+		config.LoginBackoff = DEFAULT_LOGIN_BACKOFF
+	}
+	if config.LoginLockout <= 0 {
+		config.LoginLockout = DEFAULT_LOGIN_LOCKOUT
+	}
+	if config.TrustedProxyHops <= 0 {
+		config.TrustedProxyHops = DEFAULT_TRUSTED_PROXY_HOPS
+	}
+	if config.PasswordResetTTL <= 0 {
+		config.PasswordResetTTL = DEFAULT_PASSWORD_RESET_TTL
+	}
+	if config.MailFrom == "" {
+		config.MailFrom = DEFAULT_MAIL_FROM
+	}
+	if config.PostRetention < config.PostRestoreWindow {
+		return nil, errors.New("post retention must be greater than the restore window")
+	}
+	keys, err := auth.NewKeyManager(auth.KeyConfig{
+		Algorithm:        config.JWTAlgorithm,
+		Secret:           config.JWTSecret,
+		PrivateKeyFiles:  config.JWTPrivateKeyFiles,
+		RotationInterval: config.JWTKeyRotation,
+		Overlap:          config.JWTKeyOverlap,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if keys.Ephemeral() {
+		log.Println("JWT_PRIVATE_KEY_FILES is not set, signing keys are generated in memory: tokens are invalidated when the server restarts and are not valid on other instances")
+	}
+	signer, err := auth.NewSigner(config.VerificationSecret)
+	if err != nil {
+		return nil, err
+	}
+	if config.VerificationSecret == "" {
+		log.Println("VERIFICATION_SECRET is not set, verification links will expire when the server restarts")
+	}
+	var m mailer.Mailer
+	if config.SMTPHost != "" {
+		m = mailer.NewSMTPMailer(mailer.SMTPConfig{
+			Host:     config.SMTPHost,
+			Port:     config.SMTPPort,
+			Username: config.SMTPUsername,
+			Password: config.SMTPPassword,
+			From:     config.MailFrom,
+		})
+	} else if m, err = mailer.NewLocalMailer(config.MailFrom, config.MailFile); err != nil {
+		return nil, err
+	}
+	passwords, err := auth.NewPasswordPolicy(config.PasswordMinLength, config.BreachedPasswordsFile)
+	if err != nil {
+		return nil, err
+	}
 	broker := &Broker{
-		config: config,
-		router: mux.NewRouter(),
-		hub:    websocket.NewHub(),
+		config:    config,
+		router:    mux.NewRouter(),
+		hub:       websocket.NewHub(),
+		keys:      keys,
+		signer:    signer,
+		mailer:    m,
+		passwords: passwords,
+		metrics:   metrics.NewRegistry(),
 	}
 	return broker, nil
 }
 
-func (b *Broker) Start(binder func(s Server, r *mux.Router)) {
+// AddPublisher: agrega un destino extra (por ejemplo un backplane entre instancias)
+// para los eventos del outbox, debe llamarse antes de Start
+func (b *Broker) AddPublisher(publisher outbox.Publisher) {
+	b.publishers = append(b.publishers, publisher)
+}
+
+// Keys: llaves con las que se firman y validan los tokens
+func (b *Broker) Keys() *auth.KeyManager {
+	return b.keys
+}
+
+// Signer: firma los tokens de los links que se envían por correo
+func (b *Broker) Signer() *auth.Signer {
+	return b.signer
+}
+
+func (b *Broker) Mailer() mailer.Mailer {
+	return b.mailer
+}
+
+// PasswordPolicy: requisitos de las contraseñas nuevas
+func (b *Broker) PasswordPolicy() *auth.PasswordPolicy {
+	return b.passwords
+}
+
+// Metrics: métricas de este servidor, se exponen junto a las globales del proceso
+func (b *Broker) Metrics() *metrics.Registry {
+	return b.metrics
+}
+
+// UseMailer: reemplaza el mailer configurado (por ejemplo en pruebas), debe llamarse antes de Start
+func (b *Broker) UseMailer(m mailer.Mailer) {
+	b.mailer = m
+}
+
+// UseRepository: usa repo en lugar de conectarse a la base de datos en Start, permite
+// levantar servidores con repositorios distintos (por ejemplo en pruebas), debe llamarse antes de Start
+func (b *Broker) UseRepository(repo repository.Repository) {
+	b.repo = repo
+}
+
+// publishToHub: publica los eventos del outbox a los clientes websocket conectados
+func (b *Broker) publishToHub(ctx context.Context, message models.WebsocketMessage) error {
+	b.hub.Broadcast(message, nil)
+	return nil
+}
+
+// Start: conecta el repositorio, inicia los procesos en segundo plano y levanta el servidor,
+// retorna un error si no se puede conectar a la base de datos o si el servidor se detiene
+func (b *Broker) Start(binder func(s Server, r *mux.Router) error) error {
 	b.router = mux.NewRouter()
+	b.router.Use(requestid.Middleware, trackWrites)
 	handler := cors.Default().Handler(b.router)
-	binder(b, b.router)
-	repo, err := database.NewPostgresRepository(b.config.DataUrl)
-	if err != nil {
-		log.Fatal(err)
+	if b.repo == nil {
+		repo, err := b.connectRepository()
+		if err != nil {
+			return err
+		}
+		defer repo.Close()
+		b.repo = repo
+	}
+	repo := b.repo
+	if err := binder(b, b.router); err != nil {
+		return err
 	}
 	go b.hub.Run()
-	repository.SetRespository(repo)
+	publishers := append([]outbox.Publisher{outbox.PublisherFunc(b.publishToHub)}, b.publishers...)
+	relay := outbox.NewRelay(repo, outbox.Config{
+		Interval:        b.config.OutboxInterval,
+		BatchSize:       100,
+		Retention:       b.config.OutboxRetention,
+		CleanupInterval: time.Hour,
+	}, publishers...)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go relay.Run(ctx)
+	go b.keys.Run(ctx)
+	go b.purge(ctx, repo)
 	log.Println("Starting server on port, ", b.Config().Port)
-	if err := http.ListenAndServe(b.config.Port, handler); err != nil {
-		log.Fatal("ListenAndServe: ", err)
+	return http.ListenAndServe(b.config.Port, handler)
+}
+
+// connectRepository: se conecta a la base de datos y la envuelve con las métricas y la caché
+func (b *Broker) connectRepository() (repository.Repository, error) {
+	postgres, err := database.NewPostgresRepository(context.Background(), database.Config{
+		Url:             b.config.DataUrl,
+		ReplicaUrls:     b.config.ReplicaUrls,
+		ReadYourWrites:  b.config.ReadYourWrites,
+		MaxOpenConns:    b.config.DBMaxOpenConns,
+		MaxIdleConns:    b.config.DBMaxIdleConns,
+		ConnMaxLifetime: b.config.DBConnMaxLifetime,
+		ConnMaxIdleTime: b.config.DBConnMaxIdleTime,
+		ConnectRetries:  b.config.DBConnectRetries,
+	})
+	if err != nil {
+		return nil, err
+	}
+	b.metrics.Set("database", expvar.Func(func() interface{} { return postgres.Stats() }))
+	instrumented := repository.NewInstrumentedRepository(postgres, b.config.SlowQueryThreshold)
+	b.metrics.Set("repository", expvar.Func(func() interface{} { return instrumented.Stats() }))
+	cached := repository.NewCachedRepository(instrumented, cache.NewLRU(b.config.CacheSize), b.config.CacheTTL)
+	b.metrics.Set("repository_cache", expvar.Func(func() interface{} { return cached.Stats() }))
+	return cached, nil
+}
+
+// purge: elimina periódicamente los posts borrados hace más de PostRetention y los tokens expirados
+func (b *Broker) purge(ctx context.Context, repo repository.Repository) {
+	ticker := time.NewTicker(PURGE_INTERVAL)
+	defer ticker.Stop()
+	for {
+		purged, err := repo.PurgeDeletedPosts(ctx, time.Now().Add(-b.config.PostRetention))
+		if err != nil {
+			log.Println("purge deleted posts: ", err)
+		} else if purged > 0 {
+			log.Printf("purge deleted posts: %d posts purged\n", purged)
+		}
+		purged, err = repo.PurgeExpiredTokens(ctx, time.Now())
+		if err != nil {
+			log.Println("purge expired tokens: ", err)
+		} else if purged > 0 {
+			log.Printf("purge expired tokens: %d tokens purged\n", purged)
+		}
+		purged, err = repo.PurgeLoginAttempts(ctx, time.Now().Add(-b.config.LoginLockout))
+		if err != nil {
+			log.Println("purge login attempts: ", err)
+		} else if purged > 0 {
+			log.Printf("purge login attempts: %d purged\n", purged)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 	}
 }
+
+// trackWrites: registra las escrituras de cada request para poder leer del primario después de escribir
+func trackWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(repository.WithWriteTracking(r.Context())))
+	})
+}
@@ -0,0 +1,231 @@
+package transfer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"w00k/go/rest-ws/models"
+	"w00k/go/rest-ws/repository"
+)
+
+const (
+	USER_RECORD        = "user"
+	POST_RECORD        = "post"
+	REVISION_RECORD    = "revision"
+	DEFAULT_BATCH_SIZE = 500
+	// maxLineSize: tamaño máximo de una línea al importar
+	maxLineSize = 1024 * 1024
+)
+
+// Record: una línea del archivo NDJSON, contiene un usuario, un post o una revisión según Type,
+// se exportan usuarios, posts y revisiones en ese orden para respetar las claves foráneas
+type Record struct {
+	Type     string               `json:"type"`
+	User     *models.User         `json:"user,omitempty"`
+	Post     *models.Post         `json:"post,omitempty"`
+	Revision *models.PostRevision `json:"revision,omitempty"`
+}
+
+// Progress: cantidad de registros procesados hasta el momento
+type Progress struct {
+	Users     int64
+	Posts     int64
+	Revisions int64
+}
+
+type Options struct {
+	BatchSize int // cantidad de registros que se leen o escriben por vez
+	// OnProgress: se llama después de procesar cada lote
+	OnProgress func(progress Progress)
+}
+
+func (options *Options) setDefaults() {
+	if options.BatchSize <= 0 {
+		options.BatchSize = DEFAULT_BATCH_SIZE
+	}
+	if options.OnProgress == nil {
+		options.OnProgress = func(Progress) {}
+	}
+}
+
+// Export: escribe en w todos los usuarios, posts y revisiones del repositorio en formato NDJSON,
+// conservando ids, fechas, hashes de contraseñas y versiones; se leen en una transacción de solo
+// lectura REPEATABLE READ para que el archivo refleje un único momento
+func Export(ctx context.Context, repo repository.Repository, w io.Writer, options Options) (Progress, error) {
+	options.setDefaults()
+	var progress Progress
+	writer := bufio.NewWriter(w)
+	encoder := json.NewEncoder(writer)
+
+	//todas las lecturas se hacen en una transacción sobre el mismo snapshot, así el archivo no
+	//tiene posts de usuarios que no se exportaron ni revisiones de posts que no se exportaron
+	err := repo.WithTx(repository.WithSnapshot(ctx), func(tx repository.Repository) error {
+		return export(ctx, tx, encoder, options, &progress)
+	})
+	if err != nil {
+		return progress, err
+	}
+	return progress, writer.Flush()
+}
+
+// export: escribe los usuarios, posts y revisiones en lotes usando el repositorio de la transacción
+func export(ctx context.Context, tx repository.Repository, encoder *json.Encoder, options Options, progress *Progress) error {
+	after := ""
+	for {
+		users, err := tx.ScanUsers(ctx, after, options.BatchSize)
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			if err := encoder.Encode(Record{Type: USER_RECORD, User: user}); err != nil {
+				return err
+			}
+			after = user.Id
+		}
+		progress.Users += int64(len(users))
+		options.OnProgress(*progress)
+		if len(users) < options.BatchSize {
+			break
+		}
+	}
+
+	after = ""
+	for {
+		posts, err := tx.ScanPosts(ctx, after, options.BatchSize)
+		if err != nil {
+			return err
+		}
+		for _, post := range posts {
+			if err := encoder.Encode(Record{Type: POST_RECORD, Post: post}); err != nil {
+				return err
+			}
+			after = post.Id
+		}
+		progress.Posts += int64(len(posts))
+		options.OnProgress(*progress)
+		if len(posts) < options.BatchSize {
+			break
+		}
+	}
+
+	afterPostId, afterRevision := "", 0
+	for {
+		revisions, err := tx.ScanPostRevisions(ctx, afterPostId, afterRevision, options.BatchSize)
+		if err != nil {
+			return err
+		}
+		for _, revision := range revisions {
+			if err := encoder.Encode(Record{Type: REVISION_RECORD, Revision: revision}); err != nil {
+				return err
+			}
+			afterPostId, afterRevision = revision.PostId, revision.Revision
+		}
+		progress.Revisions += int64(len(revisions))
+		options.OnProgress(*progress)
+		if len(revisions) < options.BatchSize {
+			break
+		}
+	}
+	return nil
+}
+
+// Import: lee registros NDJSON generados por Export y los guarda con upserts, cada lote
+// se guarda en una transacción, importar dos veces el mismo archivo deja los mismos datos
+// los casos que soporta son:
+// - importa todos los registros, retorna la cantidad importada
+// - una línea inválida o de tipo desconocido, retorna el error con el número de línea sin guardar su lote
+// - error al guardar un lote, retorna el error, los lotes anteriores quedan guardados
+func Import(ctx context.Context, repo repository.Repository, r io.Reader, options Options) (Progress, error) {
+	options.setDefaults()
+	var progress Progress
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+
+	batch := make([]Record, 0, options.BatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		var imported Progress
+		err := repo.WithTx(ctx, func(tx repository.Repository) error {
+			imported = Progress{}
+			for _, record := range batch {
+				switch record.Type {
+				case USER_RECORD:
+					if err := tx.UpsertUser(ctx, record.User); err != nil {
+						return fmt.Errorf("user %s: %w", record.User.Id, err)
+					}
+					imported.Users++
+				case POST_RECORD:
+					if err := tx.UpsertPost(ctx, record.Post); err != nil {
+						return fmt.Errorf("post %s: %w", record.Post.Id, err)
+					}
+					imported.Posts++
+				case REVISION_RECORD:
+					if err := tx.UpsertPostRevision(ctx, record.Revision); err != nil {
+						return fmt.Errorf("revision %s/%d: %w", record.Revision.PostId, record.Revision.Revision, err)
+					}
+					imported.Revisions++
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		progress.Users += imported.Users
+		progress.Posts += imported.Posts
+		progress.Revisions += imported.Revisions
+		batch = batch[:0]
+		options.OnProgress(progress)
+		return nil
+	}
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return progress, fmt.Errorf("line %d: %w", line, err)
+		}
+		if err := validate(record); err != nil {
+			return progress, fmt.Errorf("line %d: %w", line, err)
+		}
+		batch = append(batch, record)
+		if len(batch) >= options.BatchSize {
+			if err := flush(); err != nil {
+				return progress, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return progress, err
+	}
+	return progress, flush()
+}
+
+func validate(record Record) error {
+	switch record.Type {
+	case USER_RECORD:
+		if record.User == nil || record.User.Id == "" {
+			return errors.New("user record without id")
+		}
+	case POST_RECORD:
+		if record.Post == nil || record.Post.Id == "" {
+			return errors.New("post record without id")
+		}
+	case REVISION_RECORD:
+		if record.Revision == nil || record.Revision.PostId == "" || record.Revision.Revision <= 0 {
+			return errors.New("revision record without post id or number")
+		}
+	default:
+		return fmt.Errorf("unknown record type %q", record.Type)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"w00k/go/rest-ws/memory"
+	"w00k/go/rest-ws/models"
+	"w00k/go/rest-ws/repository"
+)
+
+// snapshotRepository: registra si Export lee dentro de una transacción sobre un snapshot
+type snapshotRepository struct {
+	*memory.MemoryRepository
+	snapshot   bool
+	outerReads int
+}
+
+func (repo *snapshotRepository) WithTx(ctx context.Context, fn func(tx repository.Repository) error) error {
+	repo.snapshot = repository.ReadsSnapshot(ctx)
+	return repo.MemoryRepository.WithTx(ctx, fn)
+}
+
+func (repo *snapshotRepository) ScanUsers(ctx context.Context, after string, limit int) ([]*models.User, error) {
+	repo.outerReads++
+	return repo.MemoryRepository.ScanUsers(ctx, after, limit)
+}
+
+func (repo *snapshotRepository) ScanPosts(ctx context.Context, after string, limit int) ([]*models.Post, error) {
+	repo.outerReads++
+	return repo.MemoryRepository.ScanPosts(ctx, after, limit)
+}
+
+func (repo *snapshotRepository) ScanPostRevisions(ctx context.Context, afterPostId string, afterRevision int, limit int) ([]*models.PostRevision, error) {
+	repo.outerReads++
+	return repo.MemoryRepository.ScanPostRevisions(ctx, afterPostId, afterRevision, limit)
+}
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	source := &snapshotRepository{MemoryRepository: memory.NewMemoryRepository()}
+	for _, id := range []string{"a", "b", "c"} {
+		if err := source.InsertUser(ctx, &models.User{Id: id, Email: id + "@mail.com", Password: "hash"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := source.InsertPost(ctx, &models.Post{Id: "post-" + id, PostContent: id, UserId: id}); err != nil {
+			t.Fatal(err)
+		}
+		if err := source.InsertPostRevision(ctx, &models.PostRevision{PostId: "post-" + id, Revision: 1, PostContent: id, EditorId: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var file bytes.Buffer
+	exported, err := Export(ctx, source, &file, Options{BatchSize: 2})
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if !source.snapshot {
+		t.Error("Export() did not read in a snapshot transaction")
+	}
+	if source.outerReads != 0 {
+		t.Errorf("Export() read %d batches outside the transaction", source.outerReads)
+	}
+	want := Progress{Users: 3, Posts: 3, Revisions: 3}
+	if exported != want {
+		t.Errorf("Export() = %+v, want %+v", exported, want)
+	}
+
+	target := memory.NewMemoryRepository()
+	imported, err := Import(ctx, target, &file, Options{BatchSize: 2})
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if imported != want {
+		t.Errorf("Import() = %+v, want %+v", imported, want)
+	}
+	post, err := target.GetPostById(ctx, "post-b")
+	if err != nil || post.PostContent != "b" || post.UserId != "b" {
+		t.Errorf("GetPostById() = %+v, %v after import", post, err)
+	}
+}
@@ -4,6 +4,10 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+// OUTBOUND_BUFFER: mensajes que pueden quedar pendientes de enviar a un cliente, si el cliente
+// no los lee a tiempo se desconecta para que no bloquee los broadcasts
+const OUTBOUND_BUFFER = 64
+
 type Client struct {
 	hub      *Hub
 	id       string
@@ -15,7 +19,7 @@ func NewClient(hub *Hub, socket *websocket.Conn) *Client {
 	return &Client{
 		hub:      hub,
 		socket:   socket,
-		outbound: make(chan []byte),
+		outbound: make(chan []byte, OUTBOUND_BUFFER),
 	}
 }
 
@@ -71,21 +71,38 @@ func (hub *Hub) onDisconnect(client *Client) {
 	//busca el indice del cliente en el slice
 	i := -1
 	for j, c := range hub.clients {
-		if c.id == client.id {
+		if c == client {
 			i = j
 		}
 	}
+	//el cliente ya se había desconectado
+	if i < 0 {
+		return
+	}
 	//borra el elemento en el en índice i
 	copy(hub.clients[i:], hub.clients[i+1:])
 	hub.clients[len(hub.clients)-1] = nil
 	hub.clients = hub.clients[:len(hub.clients)-1]
+	//termina Client.Write, Broadcast ya no puede enviarle mensajes porque no está en hub.clients
+	close(client.outbound)
 }
 
+// Broadcast: envía el mensaje a todos los clientes sin bloquearse, los clientes que tienen
+// OUTBOUND_BUFFER mensajes pendientes se desconectan
 func (hub *Hub) Broadcast(message interface{}, ignore *Client) {
 	data, _ := json.Marshal(message)
+
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
 	for _, client := range hub.clients {
-		if client != ignore {
-			client.outbound <- data
+		if client == ignore {
+			continue
+		}
+		select {
+		case client.outbound <- data:
+		default:
+			log.Println("Client too slow, disconnecting ", client.socket.RemoteAddr())
+			go func(client *Client) { hub.unregister <- client }(client)
 		}
 	}
 }